@@ -0,0 +1,475 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultJWTSecret is only meant for local development, Load logs a warning when it is used
+const DefaultJWTSecret = "secret"
+
+// Config holds every setting of the server. It is loaded once at startup and passed to the router,
+// controllers and services
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+	Random    RandomConfig    `yaml:"random" toml:"random"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	RateLimit RateLimitConfig `yaml:"rateLimit" toml:"rateLimit"`
+}
+
+type ServerConfig struct {
+	Port         int      `yaml:"port" toml:"port"`
+	ReadTimeout  Duration `yaml:"readTimeout" toml:"readTimeout"`   // reading the whole request, headers included
+	WriteTimeout Duration `yaml:"writeTimeout" toml:"writeTimeout"` // from the end of the request headers to the end of the response
+	IdleTimeout  Duration `yaml:"idleTimeout" toml:"idleTimeout"`   // keep-alive connections waiting for the next request
+	// ShutdownTimeout is how long in-flight requests are given to finish after SIGINT or SIGTERM
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+	// TrustedProxies are the addresses or CIDRs allowed to set the client IP in X-Forwarded-For, none by default
+	TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies"`
+}
+
+// Address is the address the server listens on
+func (s ServerConfig) Address() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+type DatabaseConfig struct {
+	// DSN selects the driver, see database.Dialector: an SQLite file path, postgres://... or mysql://...
+	DSN string `yaml:"dsn" toml:"dsn"`
+}
+
+type AuthConfig struct {
+	JWTSecret  string `yaml:"jwtSecret" toml:"jwtSecret"`
+	BcryptCost int    `yaml:"bcryptCost" toml:"bcryptCost"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowedOrigins" toml:"allowedOrigins"` // "*" allows every origin
+	AllowedHeaders   []string `yaml:"allowedHeaders" toml:"allowedHeaders"`
+	ExposedHeaders   []string `yaml:"exposedHeaders" toml:"exposedHeaders"`
+	AllowCredentials bool     `yaml:"allowCredentials" toml:"allowCredentials"`
+}
+
+// AllowsAllOrigins reports whether requests from any origin are allowed
+func (c CORSConfig) AllowsAllOrigins() bool {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`   // debug, info, warn or error
+	Format string `yaml:"format" toml:"format"` // json or text
+}
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter"` // none, stdout or otlp
+	// Endpoint is the URL of the OTLP/HTTP collector, e.g. http://localhost:4318. When it is empty the exporter reads
+	// the standard OTEL_EXPORTER_OTLP_* variables
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	ServiceName string  `yaml:"serviceName" toml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio"` // fraction of the traces started here that are kept
+}
+
+// RateLimitConfig limits the public routes by client IP and the protected routes by user
+type RateLimitConfig struct {
+	Enabled   bool      `yaml:"enabled" toml:"enabled"`
+	Public    RateLimit `yaml:"public" toml:"public"`       // every public route without its own limit
+	Protected RateLimit `yaml:"protected" toml:"protected"` // every protected route without its own limit
+	// Routes overrides the limit of single routes, keyed by method and pattern, e.g. "POST /login"
+	Routes map[string]RateLimit `yaml:"routes" toml:"routes"`
+}
+
+// RateLimit allows Requests per Period, with bursts of up to Burst requests
+type RateLimit struct {
+	Requests int      `yaml:"requests" toml:"requests"`
+	Period   Duration `yaml:"period" toml:"period"`
+	Burst    int      `yaml:"burst" toml:"burst"` // Requests when zero
+}
+
+// Limit returns the limit of the route, the one given for the route or else the default of its group
+func (c RateLimitConfig) Limit(method, route string, protected bool) RateLimit {
+	if limit, ok := c.Routes[method+" "+route]; ok {
+		return limit
+	}
+	if protected {
+		return c.Protected
+	}
+
+	return c.Public
+}
+
+type RandomConfig struct {
+	Provider    string          `yaml:"provider" toml:"provider"` // random.org, local or seeded
+	Seed        uint64          `yaml:"seed" toml:"seed"`         // seed of the seeded provider
+	PoolLengths []int           `yaml:"poolLengths" toml:"poolLengths"`
+	RandomOrg   RandomOrgConfig `yaml:"randomOrg" toml:"randomOrg"`
+}
+
+type RandomOrgConfig struct {
+	URL          string   `yaml:"url" toml:"url"`
+	Timeout      Duration `yaml:"timeout" toml:"timeout"`
+	Retries      int      `yaml:"retries" toml:"retries"`
+	QuotaMinBits int64    `yaml:"quotaMinBits" toml:"quotaMinBits"`
+	Fallback     string   `yaml:"fallback" toml:"fallback"` // "local" serves strings locally while random.org is unavailable
+}
+
+// Duration is a time.Duration written like "5s" in the config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the settings used when neither the config file nor the environment set them
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            8080,
+			ReadTimeout:     Duration(10 * time.Second),
+			WriteTimeout:    Duration(30 * time.Second),
+			IdleTimeout:     Duration(60 * time.Second),
+			ShutdownTimeout: Duration(15 * time.Second),
+		},
+		Database: DatabaseConfig{DSN: "calculator.db"},
+		Auth:     AuthConfig{JWTSecret: DefaultJWTSecret, BcryptCost: 14},
+		CORS: CORSConfig{
+			AllowedOrigins:   []string{"*"},
+			AllowedHeaders:   []string{"Origin", "Content-Type", "Authorization", "Accept", "User-Agent", "Cache-Control", "Pragma", "X-Request-ID", "traceparent", "tracestate", "Idempotency-Key"},
+			ExposedHeaders:   []string{"Content-Length", "X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "Idempotent-Replayed"},
+			AllowCredentials: true,
+		},
+		Random: RandomConfig{
+			Provider: "random.org",
+			Seed:     1,
+			RandomOrg: RandomOrgConfig{
+				URL:     "https://www.random.org",
+				Timeout: Duration(5 * time.Second),
+				Retries: 2,
+			},
+		},
+		Log:     LogConfig{Level: "info", Format: "json"},
+		Tracing: TracingConfig{Exporter: "none", ServiceName: "arithmetic-calculator-backend", SampleRatio: 1},
+		RateLimit: RateLimitConfig{
+			Enabled:   true,
+			Public:    RateLimit{Requests: 60, Period: Duration(time.Minute), Burst: 20},
+			Protected: RateLimit{Requests: 300, Period: Duration(time.Minute), Burst: 60},
+			Routes: map[string]RateLimit{
+				// Slow down password guessing and account spam
+				"POST /login":    {Requests: 10, Period: Duration(time.Minute), Burst: 5},
+				"POST /register": {Requests: 10, Period: Duration(time.Hour), Burst: 5},
+				// The operations spend the random.org quota
+				"POST /api/v1/operation":          {Requests: 60, Period: Duration(time.Minute), Burst: 20},
+				"POST /api/v1/records/:id/replay": {Requests: 60, Period: Duration(time.Minute), Burst: 20},
+				// A batch runs up to hundreds of operations
+				"POST /api/v1/operations/batch": {Requests: 10, Period: Duration(time.Minute), Burst: 5},
+			},
+		},
+	}
+}
+
+// Load reads the config file at path, when it isn't empty, over the defaults, applies the environment variable
+// overrides and validates the result. The file format is picked from its extension: .yaml, .yml or .toml
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.applyEnvironment(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) readFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read the config file: %w", err)
+	}
+
+	switch extension := strings.ToLower(filepath.Ext(path)); extension {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(contents, c)
+	case ".toml":
+		err = toml.Unmarshal(contents, c)
+	default:
+		return fmt.Errorf("unsupported config file extension %q, use .yaml, .yml or .toml", extension)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyEnvironment overrides the settings with the environment variables that are set
+func (c *Config) applyEnvironment(lookup func(string) (string, bool)) error {
+	var errs []error
+	setString := func(name string, target *string) {
+		if value, ok := lookup(name); ok {
+			*target = value
+		}
+	}
+	setInt := func(name string, target *int) {
+		if value, ok := lookup(name); ok {
+			parsed, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be an integer", name))
+				return
+			}
+			*target = parsed
+		}
+	}
+	setList := func(name string, target *[]string) {
+		if value, ok := lookup(name); ok {
+			*target = splitList(value)
+		}
+	}
+	setDuration := func(name string, target *Duration) {
+		if value, ok := lookup(name); ok {
+			if err := target.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a duration like 5s", name))
+			}
+		}
+	}
+
+	setInt("PORT", &c.Server.Port)
+	setDuration("SERVER_READ_TIMEOUT", &c.Server.ReadTimeout)
+	setDuration("SERVER_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	setDuration("SERVER_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	setDuration("SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	setList("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+	// DATABASE_PATH is the older name, kept working for SQLite deployments
+	setString("DATABASE_PATH", &c.Database.DSN)
+	setString("DATABASE_DSN", &c.Database.DSN)
+	setString("JWT_SECRET", &c.Auth.JWTSecret)
+	setInt("BCRYPT_COST", &c.Auth.BcryptCost)
+	setList("CORS_ALLOWED_ORIGINS", &c.CORS.AllowedOrigins)
+	setBool := func(name string, target *bool) {
+		if value, ok := lookup(name); ok {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false", name))
+				return
+			}
+			*target = parsed
+		}
+	}
+	setBool("CORS_ALLOW_CREDENTIALS", &c.CORS.AllowCredentials)
+	setBool("RATE_LIMIT_ENABLED", &c.RateLimit.Enabled)
+
+	setString("LOG_LEVEL", &c.Log.Level)
+	setString("LOG_FORMAT", &c.Log.Format)
+
+	setString("TRACING_EXPORTER", &c.Tracing.Exporter)
+	setString("TRACING_ENDPOINT", &c.Tracing.Endpoint)
+	setString("TRACING_SERVICE_NAME", &c.Tracing.ServiceName)
+	if value, ok := lookup("TRACING_SAMPLE_RATIO"); ok {
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			errs = append(errs, errors.New("TRACING_SAMPLE_RATIO must be a number between 0 and 1"))
+		}
+		c.Tracing.SampleRatio = ratio
+	}
+
+	setString("RANDOM_STRING_PROVIDER", &c.Random.Provider)
+	if value, ok := lookup("RANDOM_SEED"); ok {
+		seed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			errs = append(errs, errors.New("RANDOM_SEED must be a positive integer"))
+		}
+		c.Random.Seed = seed
+	}
+	if value, ok := lookup("RANDOM_STRING_POOL_LENGTHS"); ok {
+		c.Random.PoolLengths = nil
+		for _, length := range splitList(value) {
+			poolLength, err := strconv.Atoi(length)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid random string pool length %q", length))
+				continue
+			}
+			c.Random.PoolLengths = append(c.Random.PoolLengths, poolLength)
+		}
+	}
+
+	setString("RANDOM_ORG_URL", &c.Random.RandomOrg.URL)
+	setDuration("RANDOM_ORG_TIMEOUT", &c.Random.RandomOrg.Timeout)
+	setInt("RANDOM_ORG_RETRIES", &c.Random.RandomOrg.Retries)
+	if value, ok := lookup("RANDOM_ORG_QUOTA_MIN_BITS"); ok {
+		bits, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			errs = append(errs, errors.New("RANDOM_ORG_QUOTA_MIN_BITS must be an integer"))
+		}
+		c.Random.RandomOrg.QuotaMinBits = bits
+	}
+	setString("RANDOM_ORG_FALLBACK", &c.Random.RandomOrg.Fallback)
+
+	return errors.Join(errs...)
+}
+
+// splitList splits a comma separated list, ignoring empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, errors.New("server.port must be between 1 and 65535"))
+	}
+	for _, timeout := range []struct {
+		name  string
+		value Duration
+	}{
+		{"server.readTimeout", c.Server.ReadTimeout},
+		{"server.writeTimeout", c.Server.WriteTimeout},
+		{"server.idleTimeout", c.Server.IdleTimeout},
+		{"server.shutdownTimeout", c.Server.ShutdownTimeout},
+	} {
+		if timeout.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", timeout.name))
+		}
+	}
+
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+
+	if c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.jwtSecret is required"))
+	}
+	if c.Auth.BcryptCost < bcrypt.MinCost || c.Auth.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("auth.bcryptCost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New(`cors.allowedOrigins needs at least one origin, or "*"`))
+	}
+	if c.CORS.AllowsAllOrigins() && len(c.CORS.AllowedOrigins) > 1 {
+		errs = append(errs, errors.New(`cors.allowedOrigins can't list other origins along with "*"`))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("unknown log.level %q, use debug, info, warn or error", c.Log.Level))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("unknown log.format %q, use json or text", c.Log.Format))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("unknown tracing.exporter %q, use none, stdout or otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.Endpoint != "" && !strings.HasPrefix(c.Tracing.Endpoint, "http://") && !strings.HasPrefix(c.Tracing.Endpoint, "https://") {
+		errs = append(errs, errors.New("tracing.endpoint must be an http or https URL"))
+	}
+	if c.Tracing.ServiceName == "" {
+		errs = append(errs, errors.New("tracing.serviceName is required"))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sampleRatio must be between 0 and 1"))
+	}
+
+	if c.RateLimit.Enabled {
+		validateLimit := func(name string, limit RateLimit) {
+			if limit.Requests < 1 || limit.Period <= 0 || limit.Burst < 0 {
+				errs = append(errs, fmt.Errorf("%s needs positive requests and period, and a burst that isn't negative", name))
+			}
+		}
+		validateLimit("rateLimit.public", c.RateLimit.Public)
+		validateLimit("rateLimit.protected", c.RateLimit.Protected)
+
+		routes := make([]string, 0, len(c.RateLimit.Routes))
+		for route := range c.RateLimit.Routes {
+			routes = append(routes, route)
+		}
+		sort.Strings(routes)
+		for _, route := range routes {
+			method, pattern, ok := strings.Cut(route, " ")
+			if !ok || method == "" || !strings.HasPrefix(pattern, "/") {
+				errs = append(errs, fmt.Errorf(`rateLimit.routes key %q must be a method and a path, e.g. "POST /login"`, route))
+			}
+			validateLimit(fmt.Sprintf("rateLimit.routes[%q]", route), c.RateLimit.Routes[route])
+		}
+	}
+
+	switch c.Random.Provider {
+	case "random.org", "local", "seeded":
+	default:
+		errs = append(errs, fmt.Errorf("unknown random.provider %q, use random.org, local or seeded", c.Random.Provider))
+	}
+	for _, length := range c.Random.PoolLengths {
+		// Lengths accepted by random.org, shorter ones have too few different strings to keep handing out new ones
+		if length < 4 || length > 20 {
+			errs = append(errs, fmt.Errorf("random.poolLengths must be between 4 and 20, got %d", length))
+		}
+	}
+
+	randomOrg := c.Random.RandomOrg
+	if !strings.HasPrefix(randomOrg.URL, "http://") && !strings.HasPrefix(randomOrg.URL, "https://") {
+		errs = append(errs, errors.New("random.randomOrg.url must be an http or https URL"))
+	}
+	if randomOrg.Timeout <= 0 {
+		errs = append(errs, errors.New("random.randomOrg.timeout must be positive"))
+	}
+	if randomOrg.Retries < 0 {
+		errs = append(errs, errors.New("random.randomOrg.retries can't be negative"))
+	}
+	if randomOrg.QuotaMinBits < 0 {
+		errs = append(errs, errors.New("random.randomOrg.quotaMinBits can't be negative"))
+	}
+	if randomOrg.Fallback != "" && randomOrg.Fallback != "local" {
+		errs = append(errs, errors.New(`random.randomOrg.fallback must be empty or "local"`))
+	}
+
+	return errors.Join(errs...)
+}
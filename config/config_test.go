@@ -0,0 +1,186 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
+)
+
+// writeConfig writes a config file with the given name in a temporary directory
+func writeConfig(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("unexpected error writing the config file: %v", err)
+	}
+
+	return path
+}
+
+// TestLoad_Defaults tests the settings used without a config file or environment variables
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Server.Address() != ":8080" || cfg.Database.DSN != "calculator.db" || cfg.Auth.BcryptCost != 14 {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+	if !cfg.CORS.AllowsAllOrigins() || cfg.Random.Provider != "random.org" {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+}
+
+// TestLoad_YAML tests a YAML config file and the environment overrides
+func TestLoad_YAML(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+server:
+  port: 9000
+database:
+  dsn: /tmp/test.db
+auth:
+  jwtSecret: from-file
+  bcryptCost: 10
+cors:
+  allowedOrigins: ["https://calculator.example.com"]
+random:
+  provider: local
+  randomOrg:
+    timeout: 2s
+tracing:
+  exporter: otlp
+  endpoint: http://collector:4318
+rateLimit:
+  routes:
+    "POST /api/v1/operation": {requests: 5, period: 1m}
+`)
+	t.Setenv("JWT_SECRET", "from-env")
+	t.Setenv("RANDOM_STRING_POOL_LENGTHS", "10, 20")
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "45s")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Server.Port != 9000 || cfg.Database.DSN != "/tmp/test.db" || cfg.Auth.BcryptCost != 10 {
+		t.Errorf("expected the settings of the file, got %+v", cfg)
+	}
+	if cfg.Auth.JWTSecret != "from-env" {
+		t.Errorf("expected the environment to override the JWT secret, got %q", cfg.Auth.JWTSecret)
+	}
+	if cfg.CORS.AllowsAllOrigins() || cfg.CORS.AllowedOrigins[0] != "https://calculator.example.com" {
+		t.Errorf("unexpected allowed origins %v", cfg.CORS.AllowedOrigins)
+	}
+	if time.Duration(cfg.Random.RandomOrg.Timeout) != 2*time.Second {
+		t.Errorf("expected a timeout of 2s, got %v", time.Duration(cfg.Random.RandomOrg.Timeout))
+	}
+	if time.Duration(cfg.Server.ShutdownTimeout) != 45*time.Second || time.Duration(cfg.Server.ReadTimeout) != 10*time.Second {
+		t.Errorf("expected the shutdown timeout of the environment and the default read timeout, got %+v", cfg.Server)
+	}
+	if len(cfg.Random.PoolLengths) != 2 || cfg.Random.PoolLengths[1] != 20 {
+		t.Errorf("unexpected pool lengths %v", cfg.Random.PoolLengths)
+	}
+	if limit := cfg.RateLimit.Limit("POST", "/api/v1/operation", true); limit.Requests != 5 || limit.Burst != 0 {
+		t.Errorf("expected the limit of the file for the route, got %+v", limit)
+	}
+	if limit := cfg.RateLimit.Limit("POST", "/login", false); limit.Requests != 10 {
+		t.Errorf("expected the default limit of the other routes to be kept, got %+v", limit)
+	}
+	if cfg.Tracing.Exporter != "otlp" || cfg.Tracing.Endpoint != "http://collector:4318" || cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("unexpected tracing settings %+v", cfg.Tracing)
+	}
+	// Settings missing from the file keep their defaults
+	if cfg.Random.RandomOrg.URL != "https://www.random.org" {
+		t.Errorf("expected the default random.org URL, got %q", cfg.Random.RandomOrg.URL)
+	}
+}
+
+// TestLoad_TOML tests a TOML config file
+func TestLoad_TOML(t *testing.T) {
+	path := writeConfig(t, "config.toml", `
+[server]
+port = 9001
+
+[random]
+provider = "seeded"
+seed = 42
+
+[random.randomOrg]
+url = "http://localhost:9999"
+`)
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Server.Port != 9001 || cfg.Random.Provider != "seeded" || cfg.Random.Seed != 42 {
+		t.Errorf("expected the settings of the file, got %+v", cfg)
+	}
+	if cfg.Random.RandomOrg.URL != "http://localhost:9999" {
+		t.Errorf("unexpected random.org URL %q", cfg.Random.RandomOrg.URL)
+	}
+}
+
+// TestLoad_DatabaseDSN tests that DATABASE_DSN takes precedence over the older DATABASE_PATH
+func TestLoad_DatabaseDSN(t *testing.T) {
+	t.Setenv("DATABASE_PATH", "/tmp/old.db")
+	cfg, err := config.Load("")
+	if err != nil || cfg.Database.DSN != "/tmp/old.db" {
+		t.Fatalf("expected DATABASE_PATH to set the DSN, got %q, %v", cfg.Database.DSN, err)
+	}
+
+	t.Setenv("DATABASE_DSN", "postgres://localhost:5432/calculator")
+	cfg, err = config.Load("")
+	if err != nil || cfg.Database.DSN != "postgres://localhost:5432/calculator" {
+		t.Errorf("expected DATABASE_DSN to set the DSN, got %q, %v", cfg.Database.DSN, err)
+	}
+}
+
+// TestLoad_Invalid tests that invalid settings are rejected at startup
+func TestLoad_Invalid(t *testing.T) {
+	if _, err := config.Load(writeConfig(t, "config.json", `{}`)); err == nil {
+		t.Error("expected an error for a .json config file, but got nil")
+	}
+
+	path := writeConfig(t, "config.yaml", `
+server:
+  port: 70000
+  writeTimeout: 0s
+auth:
+  bcryptCost: 40
+random:
+  provider: dice
+  poolLengths: [2]
+log:
+  level: loud
+  format: xml
+tracing:
+  exporter: jaeger
+  sampleRatio: 2
+rateLimit:
+  routes:
+    login: {requests: 0, period: 1m}
+`)
+	_, err := config.Load(path)
+	if err == nil {
+		t.Fatal("expected an error for the invalid settings, but got nil")
+	}
+	// Every invalid setting is reported at once
+	for _, setting := range []string{"server.port", "server.writeTimeout", "auth.bcryptCost", "random.provider", "random.poolLengths", "log.level", "log.format", "tracing.exporter", "tracing.sampleRatio", `rateLimit.routes["login"]`} {
+		if !strings.Contains(err.Error(), setting) {
+			t.Errorf("expected the error to mention %s, got %v", setting, err)
+		}
+	}
+
+	t.Setenv("PORT", "eighty")
+	if _, err := config.Load(""); err == nil {
+		t.Error("expected an error for a non numeric PORT, but got nil")
+	}
+}
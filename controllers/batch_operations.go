@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+)
+
+// maxBatchOperations limits the size of a batch, so a single request can't keep the server busy for minutes
+const maxBatchOperations = 500
+
+// maxBatchRandomOperations limits the random operations of a batch, each one waits on a call to random.org and they
+// must all finish within the write timeout of the server
+const maxBatchRandomOperations = 20
+
+// The batch modes: all_or_nothing performs every operation or none of them, best_effort performs the operations it can
+const (
+	BatchAllOrNothing = "all_or_nothing"
+	BatchBestEffort   = "best_effort"
+)
+
+type BatchOperationRequest struct {
+	Mode       string             `json:"mode"` // all_or_nothing by default, or best_effort
+	Operations []OperationRequest `json:"operations"`
+}
+
+// batchItem is the outcome of one operation of a batch, the results keep the order of the request
+type batchItem struct {
+	Index       int      `json:"index"`
+	Status      int      `json:"status"`
+	Result      *string  `json:"result,omitempty"`
+	EntropyBits *float64 `json:"entropyBits,omitempty"`
+	RecordID    uint     `json:"recordId,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// fail sets the error of the item, it is attached to the context so it is logged with the request
+func (i *batchItem) fail(c *gin.Context, err error) {
+	c.Error(fmt.Errorf("batch operation %d: %w", i.Index, err))
+	i.Status, i.Error = errorResponse(err)
+}
+
+func (i *batchItem) succeed(req OperationRequest, record models.Record) {
+	i.Status = http.StatusOK
+	i.Result = &record.OperationResult
+	i.RecordID = record.ID
+	if entropy, ok := req.entropyBits(); ok {
+		i.EntropyBits = &entropy
+	}
+}
+
+// cancelPending marks the items without an outcome as not performed, another operation of an all_or_nothing batch
+// failed
+func cancelPending(items []batchItem) {
+	for i := range items {
+		if items[i].Status == 0 {
+			items[i] = batchItem{
+				Index:  items[i].Index,
+				Status: http.StatusFailedDependency,
+				Error:  "Not performed, another operation of the batch failed",
+			}
+		}
+	}
+}
+
+// PerformBatch performs a list of operations. They are all validated and their total cost is checked against the
+// balance before any of them runs. In all_or_nothing mode the user is only charged when every operation succeeds,
+// in best_effort mode the failed operations are skipped and the others are charged
+func (oc *OperationController) PerformBatch(c *gin.Context) {
+	var req BatchOperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the user ID from the request context (set by the JWT middleware)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = BatchAllOrNothing
+	}
+	if req.Mode != BatchAllOrNothing && req.Mode != BatchBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be all_or_nothing or best_effort"})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A batch must have between 1 and %d operations", maxBatchOperations)})
+		return
+	}
+	c.Set("operation", "batch") // logged with the request
+
+	ctx := c.Request.Context()
+	store := oc.Store.WithContext(ctx)
+	user, err := findUser(ctx, store, userID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	// Validate every operation and work out the total price before doing any work
+	items := make([]batchItem, len(req.Operations))
+	prepared := make([]*preparedOperation, len(req.Operations))
+	operations := map[string]models.Operation{}
+	invalid, random, totalCost := 0, 0, 0.0
+	for i, operationReq := range req.Operations {
+		items[i].Index = i
+		operation, err := oc.prepareBatchOperation(ctx, store, operations, operationReq)
+		if err != nil {
+			items[i].fail(c, err)
+			invalid++
+			continue
+		}
+		prepared[i] = &operation
+		totalCost += operation.cost
+		if operation.random {
+			random++
+		}
+	}
+
+	if random > maxBatchRandomOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A batch can have at most %d random operations", maxBatchRandomOperations)})
+		return
+	}
+
+	if invalid > 0 && req.Mode == BatchAllOrNothing {
+		cancelPending(items)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid operations in the batch, none was performed", "results": items})
+		return
+	}
+
+	if user.Balance < totalCost {
+		for _, operation := range prepared {
+			if operation != nil {
+				oc.Metrics.ObserveInsufficientBalance(operation.req.Operation)
+			}
+		}
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient balance", "totalCost": totalCost, "balance": user.Balance})
+		return
+	}
+
+	// The random operations count against the limit of single operations, so batches don't get around it
+	if random > 0 && oc.RateLimiter != nil && !oc.RateLimiter.Take(c, http.MethodPost, "/api/v1/operation", random) {
+		return
+	}
+
+	results := make([]string, len(req.Operations))
+	for i, operation := range prepared {
+		if operation == nil {
+			continue
+		}
+
+		result, err := operation.run(ctx)
+		if err != nil {
+			items[i].fail(c, err)
+			if req.Mode == BatchAllOrNothing {
+				cancelPending(items)
+				status, _ := errorResponse(err)
+				c.JSON(status, gin.H{"error": "An operation of the batch failed, none was performed", "results": items})
+				return
+			}
+			prepared[i] = nil
+			continue
+		}
+		results[i] = result
+	}
+
+	records := []models.Record{}
+	if req.Mode == BatchAllOrNothing {
+		// Every balance update and record is saved in one transaction
+		err = store.Transaction(func(store repositories.Store) error {
+			for i, operation := range prepared {
+				record, err := saveOperation(ctx, store, &user, *operation, results[i])
+				if err != nil {
+					return err
+				}
+				records = append(records, record)
+				items[i].succeed(operation.req, record)
+			}
+			return nil
+		})
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+	} else {
+		// Every operation is saved on its own, so a failed one doesn't roll back the others
+		for i, operation := range prepared {
+			if operation == nil {
+				continue
+			}
+
+			var record models.Record
+			err := store.Transaction(func(store repositories.Store) error {
+				var err error
+				record, err = saveOperation(ctx, store, &user, *operation, results[i])
+				return err
+			})
+			if err != nil {
+				items[i].fail(c, err)
+				continue
+			}
+			records = append(records, record)
+			items[i].succeed(operation.req, record)
+		}
+	}
+
+	charged := 0.0
+	response := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		oc.Metrics.ObserveOperation(record.Operation.Type, record.Amount)
+		charged += record.Amount
+		response[i] = recordResponse(record)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mode":      req.Mode,
+		"results":   items,
+		"records":   response,
+		"succeeded": len(records),
+		"failed":    len(items) - len(records),
+		"totalCost": charged,
+		"balance":   user.Balance,
+	})
+}
+
+// prepareBatchOperation validates one operation of a batch, the operations are only loaded once per type
+func (oc *OperationController) prepareBatchOperation(ctx context.Context, store repositories.Store, operations map[string]models.Operation, req OperationRequest) (preparedOperation, error) {
+	if req.Operation == "" {
+		return preparedOperation{}, &OperationError{Status: http.StatusBadRequest, Message: "operation is required"}
+	}
+
+	operation, found := operations[req.Operation]
+	if !found {
+		var err error
+		operation, err = findOperation(ctx, store, req.Operation)
+		if err != nil {
+			return preparedOperation{}, err
+		}
+		operations[req.Operation] = operation
+	}
+
+	return oc.prepareOperation(req, operation)
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+)
+
+// currentUserID returns the ID of the authenticated user set by the JWT middleware.
+// The claims are decoded from JSON, so the ID arrives as a float64
+func currentUserID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+
+	switch id := value.(type) {
+	case uint:
+		return id, true
+	case float64:
+		return uint(id), id > 0
+	default:
+		return 0, false
+	}
+}
+
+// findUserRecord loads one of the user's records from the ID in the URL
+func findUserRecord(records repositories.RecordRepository, userID uint, param string) (models.Record, error) {
+	recordID, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		return models.Record{}, repositories.ErrNotFound
+	}
+
+	return records.FindForUser(userID, uint(recordID))
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DatabaseChecker is implemented by database.Connection
+type DatabaseChecker interface {
+	Ping(ctx context.Context) error
+	CheckSchema(ctx context.Context) error
+}
+
+type HealthController struct {
+	RandomStringService services.RandomStringService
+	Database            DatabaseChecker
+	Operations          repositories.OperationRepository
+	RequiredOperations  []string // the operation types that must be seeded
+}
+
+// ComponentStatus is the readiness of one of the dependencies of the server
+type ComponentStatus struct {
+	Status string `json:"status"` // ok, fallback or down
+	Error  string `json:"error,omitempty"`
+}
+
+// Health reports the status of the random string provider, including the random.org quota when it is used
+func (hc *HealthController) Health(c *gin.Context) {
+	provider := hc.providerStatus()
+
+	status := http.StatusOK
+	if provider.Status == "unavailable" {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, gin.H{
+		"status":       provider.Status,
+		"randomString": provider,
+	})
+}
+
+// Liveness only tells that the process is up and serving requests, it doesn't check any dependency
+// so that an outage of the database or random.org doesn't get every instance restarted
+func (hc *HealthController) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness tells whether the instance can serve requests: the database is reachable, migrated and seeded, and
+// random strings can be generated either by the provider or by its fallback
+func (hc *HealthController) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	components := gin.H{}
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			components[name] = ComponentStatus{Status: "down", Error: err.Error()}
+			ready = false
+			return
+		}
+		components[name] = ComponentStatus{Status: "ok"}
+	}
+
+	// The schema and the operations can't be checked without the database
+	if err := hc.Database.Ping(ctx); err != nil {
+		check("database", err)
+		components["migrations"] = ComponentStatus{Status: "down", Error: "the database is unreachable"}
+		components["operations"] = ComponentStatus{Status: "down", Error: "the database is unreachable"}
+	} else {
+		check("database", nil)
+		check("migrations", hc.Database.CheckSchema(ctx))
+		check("operations", hc.checkOperations(ctx))
+	}
+
+	provider := hc.providerStatus()
+	randomString := gin.H{"status": "ok", "provider": provider.Provider}
+	if provider.Quota != nil {
+		randomString["quota"] = provider.Quota
+	}
+	switch {
+	case provider.Status == "fallback":
+		randomString["status"] = "fallback"
+	case provider.Status == "unavailable":
+		randomString["status"] = "down"
+		ready = false
+	case provider.Quota != nil && provider.Quota.Error != "":
+		// The quota couldn't be fetched, so random.org is unreachable from this instance
+		randomString["status"] = "down"
+		randomString["error"] = provider.Quota.Error
+		ready = false
+	}
+	components["randomString"] = randomString
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, gin.H{
+		"status":     status,
+		"components": components,
+	})
+}
+
+// checkOperations returns an error naming the operations that are missing from the database
+func (hc *HealthController) checkOperations(ctx context.Context) error {
+	operations := hc.Operations.WithContext(ctx)
+	var missing []string
+	for _, operationType := range hc.RequiredOperations {
+		if _, err := operations.FindByType(operationType); err != nil {
+			missing = append(missing, operationType)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("operations are not seeded: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func (hc *HealthController) providerStatus() services.ProviderStatus {
+	if reporter, ok := hc.RandomStringService.(services.StatusReporter); ok {
+		return reporter.Status()
+	}
+
+	return services.ProviderStatus{Provider: "unknown", Status: "ok"}
+}
@@ -0,0 +1,158 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/controllers"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// fakeDatabase returns the configured errors from the checks
+type fakeDatabase struct {
+	pingErr   error
+	schemaErr error
+}
+
+func (d *fakeDatabase) Ping(ctx context.Context) error { return d.pingErr }
+
+func (d *fakeDatabase) CheckSchema(ctx context.Context) error { return d.schemaErr }
+
+type readinessResponse struct {
+	Status     string `json:"status"`
+	Components map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"components"`
+}
+
+func getReadiness(t *testing.T, healthController *controllers.HealthController) (int, readinessResponse) {
+	router := gin.Default()
+	router.GET("/readyz", healthController.Readiness)
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response readinessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+	return w.Code, response
+}
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		database := &fakeDatabase{}
+		healthController := &controllers.HealthController{
+			RandomStringService: services.NewSeededRandomStringService(1),
+			Database:            database,
+			Operations:          store.Operations(),
+			RequiredOperations:  []string{"addition", "password"},
+		}
+
+		code, response := getReadiness(t, healthController)
+		if code != http.StatusOK || response.Status != "ready" {
+			t.Fatalf("expected the instance to be ready, got %v %+v", code, response)
+		}
+		for _, component := range []string{"database", "migrations", "operations", "randomString"} {
+			if response.Components[component].Status != "ok" {
+				t.Errorf("expected %s to be ok, got %+v", component, response.Components[component])
+			}
+		}
+
+		healthController.RequiredOperations = append(healthController.RequiredOperations, "modulo")
+		database.schemaErr = errors.New("migration 0002_example is pending")
+		code, response = getReadiness(t, healthController)
+		if code != http.StatusServiceUnavailable || response.Status != "not ready" {
+			t.Errorf("expected status Service Unavailable, got %v %+v", code, response)
+		}
+		if response.Components["operations"].Error != "operations are not seeded: modulo" {
+			t.Errorf("expected the missing operation to be named, got %+v", response.Components["operations"])
+		}
+		if response.Components["migrations"].Status != "down" {
+			t.Errorf("expected the migrations to be down, got %+v", response.Components["migrations"])
+		}
+
+		// Nothing else can be checked without the database
+		database.pingErr = errors.New("connection refused")
+		_, response = getReadiness(t, healthController)
+		if response.Components["database"].Error != "connection refused" || response.Components["operations"].Status != "down" {
+			t.Errorf("expected the database to be down, got %+v", response.Components)
+		}
+	})
+}
+
+// TestReadiness_RandomStringFallback tests that the instance stays ready while random strings are served by the fallback
+func TestReadiness_RandomStringFallback(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		breaker := services.NewCircuitBreaker(1, time.Minute)
+		breaker.Failure()
+		randomOrg := &services.RealRandomStringService{Breaker: breaker, Fallback: &services.LocalRandomStringService{}}
+		healthController := &controllers.HealthController{
+			RandomStringService: randomOrg,
+			Database:            &fakeDatabase{},
+			Operations:          store.Operations(),
+		}
+
+		code, response := getReadiness(t, healthController)
+		if code != http.StatusOK || response.Components["randomString"].Status != "fallback" {
+			t.Errorf("expected the instance to be ready in fallback mode, got %v %+v", code, response)
+		}
+
+		randomOrg.Fallback = nil
+		code, response = getReadiness(t, healthController)
+		if code != http.StatusServiceUnavailable || response.Components["randomString"].Status != "down" {
+			t.Errorf("expected the random string provider to be down, got %v %+v", code, response)
+		}
+	})
+}
+
+// TestReadiness_QuotaUnreachable tests that the instance stays ready with a fallback when the random.org quota can't
+// be fetched
+func TestReadiness_QuotaUnreachable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	options := services.DefaultRandomOrgOptions()
+	options.BaseURL, options.RetryCount = server.URL, 0
+	options.Fallback = &services.LocalRandomStringService{}
+	randomOrg := services.NewRealRandomStringService(options)
+	randomOrg.Quota.Allows(context.Background(), 1)
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		healthController := &controllers.HealthController{
+			RandomStringService: randomOrg,
+			Database:            &fakeDatabase{},
+			Operations:          store.Operations(),
+		}
+
+		code, response := getReadiness(t, healthController)
+		if code != http.StatusOK || response.Components["randomString"].Status != "fallback" {
+			t.Errorf("expected the instance to be ready in fallback mode, got %v %+v", code, response)
+		}
+
+		withoutFallback := *randomOrg
+		withoutFallback.Fallback = nil
+		healthController.RandomStringService = &withoutFallback
+		code, response = getReadiness(t, healthController)
+		if code != http.StatusServiceUnavailable || response.Components["randomString"].Status != "down" {
+			t.Errorf("expected the random string provider to be down, got %v %+v", code, response)
+		}
+	})
+}
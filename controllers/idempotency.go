@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+)
+
+// maxIdempotencyKeyLength is the size of the idempotency_key column
+const maxIdempotencyKeyLength = 255
+
+// idempotentRequest is an operation request sent with an Idempotency-Key header
+type idempotentRequest struct {
+	userID uint
+	key    string
+	hash   string // SHA-256 of the request, a retry must send the same one
+}
+
+// newIdempotentRequest reads the Idempotency-Key header, it returns nil when the client didn't send one
+func newIdempotentRequest(c *gin.Context, userID uint, req OperationRequest) (*idempotentRequest, error) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		return nil, nil
+	}
+	if !validIdempotencyKey(key) {
+		return nil, &OperationError{Status: http.StatusBadRequest, Message: "Idempotency-Key must be up to 255 printable ASCII characters"}
+	}
+
+	// The request is hashed once bound, so a retry formatting the JSON differently still matches
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, &OperationError{Status: http.StatusInternalServerError, Message: "Failed to encode the request", Err: err}
+	}
+	hash := sha256.Sum256(body)
+
+	return &idempotentRequest{userID: userID, key: key, hash: hex.EncodeToString(hash[:])}, nil
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// find returns the response stored for the key, or ErrNotFound when the key wasn't used yet.
+// Reusing a key for a different request is refused, the client most likely generated a duplicated key
+func (r *idempotentRequest) find(keys repositories.IdempotencyKeyRepository) (models.IdempotencyKey, error) {
+	stored, err := keys.Find(r.userID, r.key)
+	if err != nil {
+		return stored, err
+	}
+	if stored.RequestHash != r.hash {
+		return stored, &OperationError{Status: http.StatusUnprocessableEntity, Message: "Idempotency-Key was already used for a different request"}
+	}
+
+	return stored, nil
+}
+
+// save stores the response with the key, it runs in the transaction charging the operation, so the key is only kept
+// when the user was charged. A concurrent request with the same key makes it fail and its charge is rolled back
+func (r *idempotentRequest) save(store repositories.Store, record models.Record, response gin.H) error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return &OperationError{Status: http.StatusInternalServerError, Message: "Failed to encode the response", Err: err}
+	}
+
+	err = store.IdempotencyKeys().Create(&models.IdempotencyKey{
+		UserID:      r.userID,
+		Key:         r.key,
+		RequestHash: r.hash,
+		RecordID:    record.ID,
+		StatusCode:  http.StatusOK,
+		Response:    string(body),
+	})
+	if err != nil {
+		return &OperationError{Status: http.StatusInternalServerError, Message: "Failed to save the idempotency key", Err: err}
+	}
+
+	return nil
+}
+
+// replay writes the stored response again, the Idempotent-Replayed header tells the client it wasn't charged
+func replay(c *gin.Context, stored models.IdempotencyKey) {
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.StatusCode, "application/json; charset=utf-8", []byte(stored.Response))
+}
+
+// replayStored responds with the stored response of the key when there is one, and reports whether it responded
+func (r *idempotentRequest) replayStored(c *gin.Context, keys repositories.IdempotencyKeyRepository) bool {
+	stored, err := r.find(keys)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		respondWithError(c, err)
+		return true
+	}
+
+	replay(c, stored)
+	return true
+}
@@ -1,24 +1,138 @@
 package controllers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/metrics"
 	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
 	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+	"github.com/ricardofabila/arithmetic-calculator-backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 )
 
 type OperationRequest struct {
-	Operation string   `json:"operation" binding:"required"`
-	Number1   *float64 `json:"number1"`
-	Number2   *float64 `json:"number2"`
-	Length    *int     `json:"length"` // Length for the random string
+	Operation string `json:"operation" binding:"required"`
+	OperationInputs
+	Tags []string `json:"tags"` // Optional tags for the created record
+	Note string   `json:"note"` // Optional note for the created record
+}
+
+// OperationInputs are the operands of an operation, they are stored with every record
+type OperationInputs struct {
+	Number1 *float64      `json:"number1,omitempty"`
+	Number2 *float64      `json:"number2,omitempty"`
+	Length  *int          `json:"length,omitempty"`  // Length for the random string or the password
+	Count   *int          `json:"count,omitempty"`   // Number of random strings, integers or decimals
+	Charset *CharsetInput `json:"charset,omitempty"` // Characters of the random strings, digits, upper and lower alpha by default
+	Unique  *bool         `json:"unique,omitempty"`  // Whether the random strings must be different, true by default
+
+	Min      *int64   `json:"min,omitempty"` // Bounds for the random integers, both inclusive
+	Max      *int64   `json:"max,omitempty"`
+	Decimals *int     `json:"decimals,omitempty"` // Decimal places of the random decimals
+	Dice     string   `json:"dice,omitempty"`     // Dice notation for the dice roll, e.g. 3d6
+	Items    []string `json:"items,omitempty"`    // Items to shuffle
+
+	Classes          []string `json:"classes,omitempty"`          // Character classes of the password, all of them by default
+	Required         []string `json:"required,omitempty"`         // Classes that must appear in the password, the used classes by default
+	ExcludeAmbiguous bool     `json:"excludeAmbiguous,omitempty"` // Leave out characters like l, 1, O and 0 from the password
+	Words            *int     `json:"words,omitempty"`            // Number of words of the passphrase
+	Separator        *string  `json:"separator,omitempty"`        // Separator between the words of the passphrase
+	Capitalize       bool     `json:"capitalize,omitempty"`       // Capitalize the words of the passphrase
+}
+
+type CharsetInput struct {
+	Digits bool   `json:"digits"`
+	Upper  bool   `json:"upper"`
+	Lower  bool   `json:"lower"`
+	Custom string `json:"custom,omitempty"` // Custom alphabet, replaces the other character sets
+}
+
+// randomStringOptions builds and validates the options of the random_string operation
+func (i OperationInputs) randomStringOptions() (services.RandomStringOptions, error) {
+	length := 10 // Default length
+	if i.Length != nil {
+		length = *i.Length
+	}
+
+	options := services.DefaultRandomStringOptions(length)
+	if i.Count != nil {
+		options.Count = *i.Count
+	}
+	if i.Charset != nil {
+		options.Digits = i.Charset.Digits
+		options.UpperAlpha = i.Charset.Upper
+		options.LowerAlpha = i.Charset.Lower
+		options.Alphabet = i.Charset.Custom
+	}
+	if i.Unique != nil {
+		options.Unique = *i.Unique
+	}
+
+	return options, options.Validate()
 }
 
 type OperationController struct {
+	Store               repositories.Store
 	RandomStringService services.RandomStringService
+	RandomNumberService services.RandomNumberService
+	Metrics             *metrics.Metrics // optional
+	RateLimiter         RateLimiter      // optional, counts the random operations of the batches
+}
+
+// RateLimiter takes tokens from the rate limit of a route for requests that count as several requests to it, it
+// responds with a 429 and returns false when they are refused. It is implemented by middlewares.RateLimiter
+type RateLimiter interface {
+	Take(c *gin.Context, method, route string, tokens int) bool
+}
+
+// OperationError is returned when an operation can't be performed, Status is the HTTP status to respond with
+type OperationError struct {
+	Status  int
+	Message string
+	Err     error // the cause, logged with the request but never sent to the client
+}
+
+func (e *OperationError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// respondWithError writes an OperationError with its status, any other error is an internal server error.
+// The error is attached to the context so it is logged with the request
+func respondWithError(c *gin.Context, err error) {
+	c.Error(err)
+
+	status, message := errorResponse(err)
+	c.JSON(status, gin.H{"error": message})
+}
+
+// errorResponse returns the status and the message sent to the client for an error
+func errorResponse(err error) (int, string) {
+	var operationErr *OperationError
+	if errors.As(err, &operationErr) {
+		return operationErr.Status, operationErr.Message
+	}
+
+	// random.org can't be used right now, the client can retry later
+	if services.IsUnavailable(err) {
+		return http.StatusServiceUnavailable, err.Error()
+	}
+
+	return http.StatusInternalServerError, err.Error()
 }
 
 func (oc *OperationController) PerformOperation(c *gin.Context) {
@@ -29,159 +143,294 @@ func (oc *OperationController) PerformOperation(c *gin.Context) {
 	}
 
 	// Get the user ID from the request context (set by the JWT middleware)
-	userID, exists := c.Get("user_id")
+	userID, exists := currentUserID(c)
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
+	c.Set("operation", req.Operation) // logged with the request
 
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	// A retry of a request that was already performed gets the same response without being charged again
+	idempotent, err := newIdempotentRequest(c, userID, req)
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
+	keys := oc.Store.IdempotencyKeys().WithContext(c.Request.Context())
+	if idempotent != nil && idempotent.replayStored(c, keys) {
+		return
+	}
+
+	var saveResponse func(store repositories.Store, record models.Record) error
+	if idempotent != nil {
+		saveResponse = func(store repositories.Store, record models.Record) error {
+			response := operationResponse(req, record)
+			if req.secret() {
+				response["result"] = secretPlaceholder
+			}
+			return idempotent.save(store, record, response)
+		}
+	}
 
-	var operation models.Operation
-	if err := database.DB.Where("type = ?", req.Operation).First(&operation).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid operation type"})
+	record, err := oc.runOperation(c.Request.Context(), userID, req, saveResponse)
+	if err != nil {
+		// A concurrent request with the same key was performed first, this one was rolled back
+		if idempotent != nil && idempotent.replayStored(c, keys) {
+			return
+		}
+		respondWithError(c, err)
 		return
 	}
 
+	c.JSON(http.StatusOK, operationResponse(req, record))
+}
+
+// operationResponse is the body of a performed operation
+func operationResponse(req OperationRequest, record models.Record) gin.H {
+	response := gin.H{"result": record.OperationResult}
+	if entropy, ok := req.entropyBits(); ok {
+		response["entropyBits"] = entropy
+	}
+
+	return response
+}
+
+// runOperation performs the operation for the user, charging its current cost, and returns the created record.
+// Every step gets its own span, so the traces show where the time goes.
+// When afterCreate is set it runs in the transaction with the created record, its error rolls the charge back
+func (oc *OperationController) runOperation(ctx context.Context, userID uint, req OperationRequest, afterCreate func(store repositories.Store, record models.Record) error) (models.Record, error) {
+	store := oc.Store.WithContext(ctx)
+
+	user, err := findUser(ctx, store, userID)
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	operation, err := findOperation(ctx, store, req.Operation)
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	prepared, err := oc.prepareOperation(req, operation)
+	if err != nil {
+		return models.Record{}, err
+	}
+
 	// Check if the user has sufficient balance for the operation
-	if user.Balance < operation.Cost {
-		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient balance"})
-		return
+	if user.Balance < prepared.cost {
+		oc.Metrics.ObserveInsufficientBalance(req.Operation)
+		return models.Record{}, &OperationError{Status: http.StatusPaymentRequired, Message: "Insufficient balance"}
+	}
+
+	result, err := prepared.run(ctx)
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	// The balance and the record are saved together
+	var record models.Record
+	err = store.Transaction(func(store repositories.Store) error {
+		record, err = saveOperation(ctx, store, &user, prepared, result)
+		if err != nil {
+			return err
+		}
+
+		if afterCreate != nil {
+			return afterCreate(store, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	oc.Metrics.ObserveOperation(operation.Type, prepared.cost)
+	return record, nil
+}
+
+// preparedOperation is a validated operation request and its price, ready to be executed
+type preparedOperation struct {
+	req       OperationRequest
+	operation models.Operation
+	cost      float64
+	random    bool // served by the random providers, which may call random.org
+	execute   func(ctx context.Context) (string, error)
+}
+
+func findUser(ctx context.Context, store repositories.Store, userID uint) (models.User, error) {
+	spanCtx, span := tracing.Start(ctx, "operation.find_user")
+	user, err := store.Users().WithContext(spanCtx).FindByID(userID)
+	tracing.End(span, err)
+	if err != nil {
+		return models.User{}, &OperationError{Status: http.StatusNotFound, Message: "User not found"}
 	}
 
-	var result string
-	var err error
+	return user, nil
+}
+
+func findOperation(ctx context.Context, store repositories.Store, operationType string) (models.Operation, error) {
+	spanCtx, span := tracing.Start(ctx, "operation.find_operation", trace.WithAttributes(attribute.String("operation", operationType)))
+	operation, err := store.Operations().WithContext(spanCtx).FindByType(operationType)
+	tracing.End(span, err)
+	if err != nil {
+		return models.Operation{}, &OperationError{Status: http.StatusBadRequest, Message: "Invalid operation type"}
+	}
+
+	return operation, nil
+}
+
+// prepareOperation validates the inputs and works out the price before doing any work
+func (oc *OperationController) prepareOperation(req OperationRequest, operation models.Operation) (preparedOperation, error) {
+	prepared := preparedOperation{req: req, operation: operation, cost: operation.Cost}
 	switch req.Operation {
 	case "addition", "subtraction", "multiplication", "division":
 		if req.Number1 == nil || req.Number2 == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Both number1 and number2 are required for this operation"})
-			return
+			return prepared, &OperationError{Status: http.StatusBadRequest, Message: "Both number1 and number2 are required for this operation"}
+		}
+		prepared.execute = func(context.Context) (string, error) {
+			return services.PerformArithmeticOperation(req.Operation, *req.Number1, *req.Number2)
 		}
-		result, err = services.PerformArithmeticOperation(req.Operation, *req.Number1, *req.Number2)
 	case "square_root":
 		if req.Number1 == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "number1 is required for square root operation"})
-			return
+			return prepared, &OperationError{Status: http.StatusBadRequest, Message: "number1 is required for square root operation"}
+		}
+		prepared.execute = func(context.Context) (string, error) {
+			return services.Sqrt(*req.Number1)
 		}
-		result, err = services.Sqrt(*req.Number1)
 	case "random_string":
-		length := 10 // Default length
-		if req.Length != nil {
-			length = *req.Length
+		options, err := req.randomStringOptions()
+		if err != nil {
+			return prepared, &OperationError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+		// The price scales with the amount of randomness requested
+		prepared.cost = services.RandomStringCost(operation.Cost, options)
+		prepared.random = true
+		prepared.execute = func(ctx context.Context) (string, error) {
+			results, err := services.WithContext(oc.RandomStringService, ctx).GetRandomStrings(options)
+			return strings.Join(results, "\n"), err
+		}
+	case "password", "passphrase":
+		generate, err := prepareSecretOperation(req)
+		if err != nil {
+			return prepared, err
+		}
+		prepared.execute = func(context.Context) (string, error) {
+			return generate()
 		}
-		result, err = oc.RandomStringService.GetRandomString(length)
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported operation"})
-		return
-	}
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+		if !randomNumberOperations[req.Operation] {
+			return prepared, &OperationError{Status: http.StatusBadRequest, Message: "Unsupported operation"}
+		}
 
-	// Deduct the cost from the user's balance
-	user.Balance -= operation.Cost
-	if err := database.DB.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user balance"})
-		return
+		cost, run, err := oc.prepareRandomNumberOperation(req, operation.Cost)
+		if err != nil {
+			return prepared, err
+		}
+		prepared.cost, prepared.random = cost, true
+		prepared.execute = func(ctx context.Context) (string, error) {
+			return run(services.WithContext(oc.RandomNumberService, ctx))
+		}
 	}
 
-	record := models.Record{
-		OperationID:     operation.ID,
-		UserID:          user.ID,
-		Amount:          operation.Cost,
-		UserBalance:     user.Balance,
-		OperationResult: result,
-		Date:            time.Now().Format(time.RFC3339),
-	}
+	return prepared, nil
+}
 
-	if err := database.DB.Create(&record).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create record"})
-		return
-	}
+// run executes the operation, the random operations call random.org from here so their requests are children of
+// this span
+func (p preparedOperation) run(ctx context.Context) (string, error) {
+	spanCtx, span := tracing.Start(ctx, "operation.execute", trace.WithAttributes(attribute.String("operation", p.req.Operation)))
+	result, err := p.execute(spanCtx)
+	tracing.End(span, err)
 
-	c.JSON(http.StatusOK, gin.H{"result": result})
+	return result, err
 }
 
-func GetRecords(c *gin.Context) {
-	// Get the user ID from the request context (set by the JWT middleware)
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
+// saveOperation charges the user for the executed operation and creates its record, it must run in a transaction
+func saveOperation(ctx context.Context, store repositories.Store, user *models.User, prepared preparedOperation, result string) (models.Record, error) {
+	inputs, err := json.Marshal(prepared.req.OperationInputs)
+	if err != nil {
+		return models.Record{}, &OperationError{Status: http.StatusInternalServerError, Message: "Failed to encode operation inputs", Err: err}
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset := (page - 1) * limit
-	search := c.Query("search")
-
-	// Start building the query
-	query := database.DB.Where("user_id = ?", userID)
+	tags, err := store.Records().FindOrCreateTags(user.ID, prepared.req.Tags)
+	if err != nil {
+		return models.Record{}, &OperationError{Status: http.StatusInternalServerError, Message: "Failed to save tags", Err: err}
+	}
 
-	// Apply search filter if search parameter is present
-	if search != "" {
-		query = query.Where("operation_result LIKE ?", "%"+search+"%")
+	// Deduct the cost from the user's balance. It is checked again by the update, the balance read before executing
+	// the operation may have been spent by a concurrent request since
+	spanCtx, span := tracing.Start(ctx, "operation.save_balance")
+	balance, err := store.Users().WithContext(spanCtx).Charge(user.ID, prepared.cost)
+	tracing.End(span, err)
+	if errors.Is(err, repositories.ErrInsufficientBalance) {
+		return models.Record{}, &OperationError{Status: http.StatusPaymentRequired, Message: "Insufficient balance"}
+	}
+	if err != nil {
+		return models.Record{}, &OperationError{Status: http.StatusInternalServerError, Message: "Failed to update user balance", Err: err}
 	}
+	user.Balance = balance
 
-	// Get the total count of records for the current user
-	var totalCount int64
-	if err := query.Model(&models.Record{}).Count(&totalCount).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch total record count"})
-		return
+	record := models.Record{
+		OperationID:     prepared.operation.ID,
+		UserID:          user.ID,
+		Amount:          prepared.cost,
+		UserBalance:     user.Balance,
+		OperationResult: result,
+		Inputs:          string(inputs),
+		Date:            time.Now().Format(time.RFC3339),
+		Note:            prepared.req.Note,
+		Tags:            tags,
 	}
-	totalPages := (totalCount + int64(limit) - 1) / int64(limit)
 
-	var records []models.Record
-	// using offset pagination and not a cursor to keep things simple
-	if err := query.Preload("Operation").Limit(limit).Offset(offset).Find(&records).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch records"})
-		return
+	if prepared.req.secret() {
+		record.OperationResult = secretPlaceholder
 	}
 
-	responseRecords := []map[string]interface{}{}
-	for _, record := range records {
-		responseRecords = append(responseRecords, map[string]interface{}{
-			"id":        record.ID,
-			"amount":    record.Amount,
-			"date":      record.Date,
-			"result":    record.OperationResult,
-			"operation": record.Operation.Type,
-		})
+	spanCtx, span = tracing.Start(ctx, "operation.create_record")
+	err = store.Records().WithContext(spanCtx).Create(&record)
+	tracing.End(span, err)
+	if err != nil {
+		return models.Record{}, &OperationError{Status: http.StatusInternalServerError, Message: "Failed to create record", Err: err}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"records":    responseRecords,
-		"totalPages": totalPages,
-	})
+	// The client still gets the generated result
+	record.OperationResult = result
+	record.Operation = prepared.operation
+	return record, nil
 }
 
-func DeleteRecord(c *gin.Context) {
+// ReplayRecord re-executes the operation and inputs stored in one of the user's records,
+// charging the current price, and returns the new record
+func (oc *OperationController) ReplayRecord(c *gin.Context) {
 	// Get the user ID from the request context (set by the JWT middleware)
-	userID, exists := c.Get("user_id")
+	userID, exists := currentUserID(c)
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	// Get the record ID from the URL parameter
-	recordID := c.Param("id")
-
-	var record models.Record
-	if err := database.DB.Where("id = ? AND user_id = ?", recordID, userID).First(&record).Error; err != nil {
+	record, err := findUserRecord(oc.Store.Records().WithContext(c.Request.Context()), userID, c.Param("id"))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
 		return
 	}
 
-	if err := database.DB.Delete(&record).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete record"})
+	// Records created before the inputs were stored can't be replayed
+	var inputs OperationInputs
+	if err := json.Unmarshal([]byte(record.Inputs), &inputs); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Record has no stored inputs to replay"})
+		return
+	}
+
+	c.Set("operation", record.Operation.Type)
+	replayed, err := oc.runOperation(c.Request.Context(), userID, OperationRequest{
+		Operation:       record.Operation.Type,
+		OperationInputs: inputs,
+	}, nil)
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Record deleted successfully"})
+	c.JSON(http.StatusOK, recordResponse(replayed))
 }
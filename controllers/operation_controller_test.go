@@ -2,119 +2,857 @@ package controllers_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"github.com/ricardofabila/arithmetic-calculator-backend/services"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
 	"github.com/ricardofabila/arithmetic-calculator-backend/controllers"
 	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/database/testdb"
+	"github.com/ricardofabila/arithmetic-calculator-backend/metrics"
+	"github.com/ricardofabila/arithmetic-calculator-backend/middlewares"
 	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+	"github.com/ricardofabila/arithmetic-calculator-backend/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
-func setupTestDatabase() {
-	// Connect to an in-memory SQLite database for testing
-	database.ConnectDatabase(":memory:")
+// TestMain stops the embedded PostgreSQL server once the tests are done, see testdb.Main
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m))
+}
 
-	// Create a test user
-	testUser := models.User{
-		Username: "testuser@example.com",
-		Password: "password123",
-		Balance:  100.0,
-		Status:   "active",
-	}
-	database.DB.Create(&testUser)
+// runWithStores runs the test on the in-memory store and on every database backend, see testdb.Run. Every store has
+// a test user and the operations
+func runWithStores(t *testing.T, test func(t *testing.T, store repositories.Store)) {
+	testdb.Run(t, func(t *testing.T, store repositories.Store) {
+		// Create a test user
+		testUser := models.User{
+			Username: "testuser@example.com",
+			Password: "password123",
+			Balance:  100.0,
+			Status:   "active",
+		}
+		store.Users().Create(&testUser)
+
+		// Seed operations using the new reusable function
+		database.SeedOperations(store.Operations())
 
-	// Seed operations using the new reusable function
-	database.SeedOperations(database.DB)
+		test(t, store)
+	})
 }
 
-func TestPerformOperation_Success_WithMockRandomString(t *testing.T) {
-	setupTestDatabase()
+// alphanumeric matches strings made of the default random string characters
+var alphanumeric = regexp.MustCompile(`^[0-9A-Za-z]+$`)
 
-	mockRandomStringService := &services.MockRandomStringService{}
+func TestPerformOperation_Success_WithSeededRandomString(t *testing.T) {
+	t.Parallel()
 
-	// Create the controller instance with the mock service
-	operationController := controllers.OperationController{
-		RandomStringService: mockRandomStringService,
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+
+		seededRandomStringService := services.NewSeededRandomStringService(1)
+
+		// Create the controller instance with the seeded service
+		operationController := controllers.OperationController{
+			Store:               store,
+			RandomStringService: seededRandomStringService,
+		}
+
+		router := gin.Default()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1)) // Mock user authentication
+			operationController.PerformOperation(c)
+		})
+
+		// Create a test request for the "random_string" operation
+		jsonBody := `{"operation": "random_string", "length": 10}`
+		req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status OK, got %v", w.Code)
+		}
+
+		var response struct {
+			Result string `json:"result"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if len(response.Result) != 10 || !alphanumeric.MatchString(response.Result) {
+			t.Errorf("expected an alphanumeric string of length 10, but got %s", w.Body.String())
+		}
+
+		// The same seed gives the same string
+		expected, _ := services.NewSeededRandomStringService(1).GetRandomString(10)
+		if response.Result != expected {
+			t.Errorf("expected %s for seed 1, but got %s", expected, response.Result)
+		}
+	})
+}
+
+func TestGetRecords_Success(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		recordController := &controllers.RecordController{Records: store.Records()}
+
+		router := gin.Default()
+		router.GET("/records", func(c *gin.Context) {
+			c.Set("user_id", uint(1)) // Mock user authentication
+			recordController.GetRecords(c)
+		})
+
+		req, _ := http.NewRequest("GET", "/records?page=1&limit=10", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status OK, got %v", w.Code)
+		}
+
+		if w.Body.Len() == 0 {
+			t.Errorf("expected records, but got none")
+		}
+	})
+}
+
+func TestDeleteRecord_Success(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		recordController := &controllers.RecordController{Records: store.Records()}
+
+		// Create a record for testing deletion
+		testRecord := models.Record{
+			UserID:      1,
+			OperationID: 1,
+			Amount:      1.0,
+			UserBalance: 99.0,
+		}
+		store.Records().Create(&testRecord)
+
+		router := gin.Default()
+		router.DELETE("/records/:id", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			recordController.DeleteRecord(c)
+		})
+
+		req, _ := http.NewRequest("DELETE", "/records/1", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status OK, got %v", w.Code)
+		}
+
+		// Verify the record has been deleted
+		if _, err := store.Records().FindForUser(1, 1); err == nil {
+			t.Errorf("expected record to be deleted, but found it")
+		}
+	})
+}
+
+func TestReplayRecord_Success(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+
+		operationController := controllers.OperationController{
+			Store:               store,
+			RandomStringService: services.NewSeededRandomStringService(1),
+		}
+
+		router := gin.Default()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformOperation(c)
+		})
+		router.POST("/records/:id/replay", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.ReplayRecord(c)
+		})
+
+		jsonBody := `{"operation": "multiplication", "number1": 6, "number2": 7}`
+		req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		req, _ = http.NewRequest("POST", "/records/1/replay", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		var record struct {
+			ID        uint   `json:"id"`
+			Result    string `json:"result"`
+			Operation string `json:"operation"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+		if record.ID != 2 || record.Result != "42" || record.Operation != "multiplication" {
+			t.Errorf("expected a new multiplication record with result 42, got %+v", record)
+		}
+
+		// Both runs are charged
+		user, _ := store.Users().FindByID(1)
+		if user.Balance != 97 {
+			t.Errorf("expected balance 97, got %v", user.Balance)
+		}
+	})
+}
+
+func TestPerformOperation_IdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+
+		operationController := controllers.OperationController{
+			Store:               store,
+			RandomStringService: services.NewSeededRandomStringService(1),
+		}
+
+		router := gin.Default()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformOperation(c)
+		})
+
+		perform := func(key, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		first := perform("key-1", `{"operation": "random_string", "length": 10}`)
+		if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("expected status OK for the first request, got %v: %s", first.Code, first.Body.String())
+		}
+		charged, _ := store.Users().FindByID(1)
+
+		// The retry gets the same string although the service would generate a new one, and isn't charged
+		retry := perform("key-1", `{"length": 10, "operation": "random_string"}`)
+		if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+			t.Errorf("expected the first response %s, got %v: %s", first.Body.String(), retry.Code, retry.Body.String())
+		}
+		if retry.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("expected the Idempotent-Replayed header, got %v", retry.Header())
+		}
+		user, _ := store.Users().FindByID(1)
+		page, _ := store.Records().List(1, repositories.RecordFilter{}, 10, 0)
+		if user.Balance != charged.Balance || page.Total != 1 {
+			t.Errorf("expected a single charge and record, got balance %v and %d records", user.Balance, page.Total)
+		}
+
+		// The same key with another request is refused
+		if w := perform("key-1", `{"operation": "random_string", "length": 12}`); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status 422 for a different request, got %v: %s", w.Code, w.Body.String())
+		}
+
+		// Other keys are performed
+		if w := perform("key-2", `{"operation": "random_string", "length": 10}`); w.Code != http.StatusOK || w.Body.String() == first.Body.String() {
+			t.Errorf("expected a new string for another key, got %v: %s", w.Code, w.Body.String())
+		}
+
+		if w := perform(strings.Repeat("k", 256), `{"operation": "addition", "number1": 1, "number2": 2}`); w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for a too long key, got %v", w.Code)
+		}
+	})
+}
+
+// TestPerformOperation_IdempotencyKeyFailure tests that failed requests aren't stored, so they can be retried
+func TestPerformOperation_IdempotencyKeyFailure(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		operationController := controllers.OperationController{Store: store}
+
+		router := gin.Default()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformOperation(c)
+		})
+
+		perform := func(body string) int {
+			req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "key-1")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		if code := perform(`{"operation": "addition", "number1": 1}`); code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %v", code)
+		}
+		if code := perform(`{"operation": "addition", "number1": 1, "number2": 2}`); code != http.StatusOK {
+			t.Errorf("expected the key to be usable after a failure, got %v", code)
+		}
+	})
+}
+
+// TestPerformOperation_Concurrent tests that concurrent operations are all charged
+func TestPerformOperation_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		if !testdb.Isolated(path.Base(t.Name())) {
+			t.Skip("the MySQL stand-in doesn't isolate concurrent updates")
+		}
+		operationController := controllers.OperationController{Store: store}
+
+		router := gin.New()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformOperation(c)
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest("POST", "/operation", strings.NewReader(`{"operation": "addition", "number1": 1, "number2": 2}`))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Errorf("expected status OK, got %v: %s", w.Code, w.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+
+		user, _ := store.Users().FindByID(1)
+		page, _ := store.Records().List(1, repositories.RecordFilter{}, 100, 0)
+		if user.Balance != 80 || page.Total != 20 {
+			t.Errorf("expected balance 80 and 20 records, got %v and %d", user.Balance, page.Total)
+		}
+	})
+}
+
+func TestPerformOperation_RandomStringOptions(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+
+		operationController := controllers.OperationController{
+			Store:               store,
+			RandomStringService: services.NewSeededRandomStringService(1),
+		}
+
+		router := gin.Default()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformOperation(c)
+		})
+
+		// random.org only supports lengths from 1 to 20
+		jsonBody := `{"operation": "random_string", "length": 21}`
+		req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request, got %v", w.Code)
+		}
+
+		// Three strings of length 20 cost six times the default string
+		jsonBody = `{"operation": "random_string", "length": 20, "count": 3, "charset": {"digits": true, "upper": true, "lower": true}}`
+		req, _ = http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		record, _ := store.Records().FindForUser(1, 1)
+		results := strings.Split(record.OperationResult, "\n")
+		if record.Amount != 15 || len(results) != 3 {
+			t.Errorf("expected 3 strings for 15 credits, got %q for %v", record.OperationResult, record.Amount)
+		}
+		for _, result := range results {
+			if len(result) != 20 || !alphanumeric.MatchString(result) {
+				t.Errorf("expected an alphanumeric string of length 20, got %q", result)
+			}
+		}
+
+		// Only the custom alphabet is used
+		jsonBody = `{"operation": "random_string", "length": 8, "charset": {"custom": "abc"}}`
+		req, _ = http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		custom, _ := store.Records().FindForUser(1, 2)
+		if len(custom.OperationResult) != 8 || strings.Trim(custom.OperationResult, "abc") != "" {
+			t.Errorf("expected 8 characters from abc, got %q", custom.OperationResult)
+		}
+	})
+}
+
+func TestPerformOperation_RandomNumbers(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+
+		operationController := controllers.OperationController{
+			Store:               store,
+			RandomStringService: services.NewSeededRandomStringService(1),
+			RandomNumberService: &services.LocalRandomStringService{},
+		}
+
+		router := gin.Default()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformOperation(c)
+		})
+
+		tests := []struct {
+			body   string
+			status int
+		}{
+			{`{"operation": "random_integer", "min": 1, "max": 6, "count": 2}`, http.StatusOK},
+			{`{"operation": "random_integer", "min": 6, "max": 1}`, http.StatusBadRequest},
+			{`{"operation": "random_decimal", "decimals": 4}`, http.StatusOK},
+			{`{"operation": "uuid_v4"}`, http.StatusOK},
+			{`{"operation": "uuid_v7"}`, http.StatusOK},
+			{`{"operation": "dice_roll", "dice": "3d6"}`, http.StatusOK},
+			{`{"operation": "dice_roll", "dice": "three dice"}`, http.StatusBadRequest},
+			{`{"operation": "shuffle", "items": ["a", "b", "c"]}`, http.StatusOK},
+			{`{"operation": "shuffle"}`, http.StatusBadRequest},
+		}
+
+		for _, test := range tests {
+			req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Errorf("expected status %v for %s, got %v: %s", test.status, test.body, w.Code, w.Body.String())
+			}
+		}
+
+		// Two integers cost twice the price of the operation
+		record, _ := store.Records().FindForUser(1, 1)
+		if record.Amount != 2 || len(strings.Split(record.OperationResult, "\n")) != 2 {
+			t.Errorf("expected 2 integers for 2 credits, got %q for %v", record.OperationResult, record.Amount)
+		}
+	})
+}
+
+// TestPerformOperation_Password tests that the secrets are generated without a random number provider and are left out
+// of the history
+func TestPerformOperation_Password(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+
+		operationController := controllers.OperationController{
+			Store:               store,
+			RandomStringService: services.NewSeededRandomStringService(1),
+		}
+
+		router := gin.Default()
+		router.POST("/operation", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformOperation(c)
+		})
+
+		tests := []struct {
+			body    string
+			status  int
+			entropy float64
+		}{
+			{`{"operation": "password", "length": 12, "classes": ["digits"]}`, http.StatusOK, 39.86},
+			{`{"operation": "password", "length": 2}`, http.StatusBadRequest, 0},
+			{`{"operation": "password", "classes": ["emoji"]}`, http.StatusBadRequest, 0},
+			{`{"operation": "passphrase", "words": 6}`, http.StatusOK, 77.55},
+			{`{"operation": "passphrase", "words": 1}`, http.StatusBadRequest, 0},
+		}
+
+		for _, test := range tests {
+			req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Errorf("expected status %v for %s, got %v: %s", test.status, test.body, w.Code, w.Body.String())
+				continue
+			}
+			if test.status != http.StatusOK {
+				continue
+			}
+
+			var response struct {
+				Result      string  `json:"result"`
+				EntropyBits float64 `json:"entropyBits"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if response.EntropyBits != test.entropy {
+				t.Errorf("expected %v bits of entropy for %s, got %v", test.entropy, test.body, response.EntropyBits)
+			}
+
+			page, _ := store.Records().List(1, repositories.RecordFilter{}, 1, 0)
+			if response.Result == "" || response.Result == "********" || page.Records[0].OperationResult != "********" {
+				t.Errorf("expected the secret to be sent but not stored, got %q and %q", response.Result, page.Records[0].OperationResult)
+			}
+		}
+
+		// A replay doesn't have the secret either
+		for i, expected := range []string{"", "********"} {
+			req, _ := http.NewRequest("POST", "/operation", strings.NewReader(`{"operation": "password"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "password-key")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var response struct {
+				Result string `json:"result"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if w.Code != http.StatusOK || (expected != "" && response.Result != expected) || (expected == "" && len(response.Result) != 16) {
+				t.Errorf("expected request %d to respond %q, got %v %s", i, expected, w.Code, w.Body.String())
+			}
+		}
+	})
+}
+
+// TestPerformOperation_Tracing tests that the steps of an operation, its queries and its call to random.org are
+// traced as part of the trace of the caller
+func TestPerformOperation_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	// Only the propagator matters here, nothing is exported
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: "none"}, nil); err != nil {
+		t.Fatalf("unexpected error setting up tracing: %v", err)
 	}
 
-	router := gin.Default()
+	// The plugin and the HTTP transport are created once the test provider is installed
+	store := testdb.Open(t, testdb.SQLite).Store()
+	store.Users().Create(&models.User{Username: "testuser@example.com", Password: "password123", Balance: 100, Status: "active"})
+	database.SeedOperations(store.Operations())
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var traceparent string
+	randomOrg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte("abcdefghij\n"))
+	}))
+	defer randomOrg.Close()
+	options := services.DefaultRandomOrgOptions()
+	options.BaseURL = randomOrg.URL
+	options.QuotaTTL = 0
+
+	operationController := controllers.OperationController{
+		Store:               store,
+		RandomStringService: services.NewRealRandomStringService(options),
+	}
+	router := gin.New()
+	router.Use(middlewares.TracingMiddleware("calculator-test"))
 	router.POST("/operation", func(c *gin.Context) {
 		c.Set("user_id", uint(1)) // Mock user authentication
 		operationController.PerformOperation(c)
 	})
 
-	// Create a test request for the "random_string" operation
-	jsonBody := `{"operation": "random_string", "length": 10}`
-	req, _ := http.NewRequest("POST", "/operation", bytes.NewBuffer([]byte(jsonBody)))
+	req, _ := http.NewRequest("POST", "/operation", strings.NewReader(`{"operation": "random_string", "length": 10}`))
 	req.Header.Set("Content-Type", "application/json")
-
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
-
 	if w.Code != http.StatusOK {
-		t.Errorf("expected status OK, got %v", w.Code)
+		t.Fatalf("expected status OK, got %v %s", w.Code, w.Body.String())
+	}
+
+	// The first span of every name, the users are selected again when charging
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if _, seen := spans[span.Name()]; !seen && span.SpanContext().TraceID().String() == traceID {
+			spans[span.Name()] = span
+		}
 	}
 
-	expectedResult := `{"result":"MOCKSTRING"}`
-	if w.Body.String() != expectedResult {
-		t.Errorf("expected response %s, but got %s", expectedResult, w.Body.String())
+	for _, name := range []string{"/operation", "operation.find_user", "operation.find_operation", "operation.execute",
+		"operation.save_balance", "operation.create_record", "GET random.org/strings/"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("expected a %s span in the trace of the caller, got %v", name, spans)
+		}
+	}
+	// The queries and the call to random.org are children of the steps that make them
+	for child, parent := range map[string]string{
+		"select users":            "operation.find_user",
+		"update users":            "operation.save_balance",
+		"insert records":          "operation.create_record",
+		"GET random.org/strings/": "operation.execute",
+	} {
+		if spans[child] == nil || spans[parent] == nil || spans[child].Parent().SpanID() != spans[parent].SpanContext().SpanID() {
+			t.Errorf("expected the %s span to be a child of %s", child, parent)
+		}
+	}
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("expected the trace context to be sent to random.org, got %q", traceparent)
 	}
 }
 
-func TestGetRecords_Success(t *testing.T) {
-	setupTestDatabase()
+// batchResponse is the body of a performed batch
+type batchResponse struct {
+	Results []struct {
+		Index    int     `json:"index"`
+		Status   int     `json:"status"`
+		Result   *string `json:"result"`
+		RecordID uint    `json:"recordId"`
+		Error    string  `json:"error"`
+	} `json:"results"`
+	Records   []map[string]interface{} `json:"records"`
+	Succeeded int                      `json:"succeeded"`
+	Failed    int                      `json:"failed"`
+	TotalCost float64                  `json:"totalCost"`
+	Balance   float64                  `json:"balance"`
+}
 
-	router := gin.Default()
-	router.GET("/records", func(c *gin.Context) {
-		c.Set("user_id", uint(1)) // Mock user authentication
-		controllers.GetRecords(c)
-	})
+func TestPerformBatch(t *testing.T) {
+	t.Parallel()
 
-	req, _ := http.NewRequest("GET", "/records?page=1&limit=10", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status OK, got %v", w.Code)
+	tests := []struct {
+		name      string
+		body      string
+		code      int
+		statuses  []int
+		succeeded int
+		balance   float64
+	}{
+		{
+			name:      "all or nothing",
+			body:      `{"operations": [{"operation": "addition", "number1": 1, "number2": 2}, {"operation": "multiplication", "number1": 6, "number2": 7}]}`,
+			code:      http.StatusOK,
+			statuses:  []int{200, 200},
+			succeeded: 2,
+			balance:   97.5,
+		},
+		{
+			name:     "all or nothing with an invalid operation",
+			body:     `{"mode": "all_or_nothing", "operations": [{"operation": "addition", "number1": 1, "number2": 2}, {"operation": "addition", "number1": 1}]}`,
+			code:     http.StatusBadRequest,
+			statuses: []int{424, 400},
+			balance:  100,
+		},
+		{
+			name:     "all or nothing with a failed operation",
+			body:     `{"operations": [{"operation": "addition", "number1": 1, "number2": 2}, {"operation": "division", "number1": 1, "number2": 0}, {"operation": "addition", "number1": 3, "number2": 4}]}`,
+			code:     http.StatusInternalServerError,
+			statuses: []int{424, 500, 424},
+			balance:  100,
+		},
+		{
+			name:      "best effort",
+			body:      `{"mode": "best_effort", "operations": [{"operation": "addition", "number1": 1, "number2": 2}, {"operation": "unknown"}, {"operation": "division", "number1": 1, "number2": 0}, {"operation": "multiplication", "number1": 6, "number2": 7}]}`,
+			code:      http.StatusOK,
+			statuses:  []int{200, 400, 500, 200},
+			succeeded: 2,
+			balance:   97.5,
+		},
+		{
+			name:    "insufficient balance",
+			body:    `{"operations": [` + strings.Repeat(`{"operation": "multiplication", "number1": 6, "number2": 7}, `, 67) + `{"operation": "addition", "number1": 1, "number2": 2}]}`,
+			code:    http.StatusPaymentRequired,
+			balance: 100,
+		},
+		{
+			name:    "too many random operations",
+			body:    `{"operations": [` + strings.Repeat(`{"operation": "random_string", "length": 5}, `, 20) + `{"operation": "random_string", "length": 5}]}`,
+			code:    http.StatusBadRequest,
+			balance: 100,
+		},
+		{
+			name:    "invalid mode",
+			body:    `{"mode": "sometimes", "operations": [{"operation": "addition", "number1": 1, "number2": 2}]}`,
+			code:    http.StatusBadRequest,
+			balance: 100,
+		},
+		{
+			name:    "empty batch",
+			body:    `{"operations": []}`,
+			code:    http.StatusBadRequest,
+			balance: 100,
+		},
 	}
 
-	if w.Body.Len() == 0 {
-		t.Errorf("expected records, but got none")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			runWithStores(t, func(t *testing.T, store repositories.Store) {
+				operationController := controllers.OperationController{Store: store}
+
+				router := gin.Default()
+				router.POST("/operations/batch", func(c *gin.Context) {
+					c.Set("user_id", uint(1))
+					operationController.PerformBatch(c)
+				})
+
+				req, _ := http.NewRequest("POST", "/operations/batch", bytes.NewBuffer([]byte(test.body)))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != test.code {
+					t.Fatalf("expected status %v, got %v: %s", test.code, w.Code, w.Body.String())
+				}
+
+				var response batchResponse
+				json.Unmarshal(w.Body.Bytes(), &response)
+				if len(response.Results) != len(test.statuses) {
+					t.Fatalf("expected %d results, got %s", len(test.statuses), w.Body.String())
+				}
+				for i, result := range response.Results {
+					if result.Index != i || result.Status != test.statuses[i] {
+						t.Errorf("expected status %v for operation %d, got %+v", test.statuses[i], i, result)
+					}
+					if (result.Status == http.StatusOK) != (result.Result != nil && result.RecordID != 0) || (result.Status != http.StatusOK) != (result.Error != "") {
+						t.Errorf("expected either a result and a record or an error for operation %d, got %+v", i, result)
+					}
+				}
+				if response.Succeeded != test.succeeded || len(response.Records) != test.succeeded {
+					t.Errorf("expected %d operations to succeed, got %s", test.succeeded, w.Body.String())
+				}
+
+				user, _ := store.Users().FindByID(1)
+				page, _ := store.Records().List(1, repositories.RecordFilter{}, 100, 0)
+				if user.Balance != test.balance || page.Total != int64(test.succeeded) {
+					t.Errorf("expected balance %v and %d records, got %v and %d", test.balance, test.succeeded, user.Balance, page.Total)
+				}
+				if test.succeeded > 0 && (response.Balance != test.balance || response.TotalCost != 100-test.balance) {
+					t.Errorf("expected the charged cost and the new balance, got %s", w.Body.String())
+				}
+			})
+		})
 	}
 }
 
-func TestDeleteRecord_Success(t *testing.T) {
-	setupTestDatabase()
-
-	// Create a record for testing deletion
-	testRecord := models.Record{
-		UserID:      1,
-		OperationID: 1,
-		Amount:      1.0,
-		UserBalance: 99.0,
-	}
-	database.DB.Create(&testRecord)
+// TestPerformBatch_InsufficientBalanceMetric tests that every operation of a batch refused for its cost is counted
+func TestPerformBatch_InsufficientBalanceMetric(t *testing.T) {
+	t.Parallel()
+
+	body := `{"operations": [` + strings.Repeat(`{"operation": "multiplication", "number1": 6, "number2": 7}, `, 67) + `{"operation": "addition", "number1": 1, "number2": 2}]}`
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		m := metrics.New()
+		operationController := controllers.OperationController{Store: store, Metrics: m}
+
+		router := gin.New()
+		router.POST("/operations/batch", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformBatch(c)
+		})
+
+		req, _ := http.NewRequest("POST", "/operations/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusPaymentRequired {
+			t.Fatalf("expected status %v, got %v: %s", http.StatusPaymentRequired, w.Code, w.Body.String())
+		}
 
-	router := gin.Default()
-	router.DELETE("/records/:id", func(c *gin.Context) {
-		c.Set("user_id", uint(1))
-		controllers.DeleteRecord(c)
+		w = httptest.NewRecorder()
+		m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		for _, expected := range []string{
+			`calculator_insufficient_balance_total{operation="addition"} 1`,
+			`calculator_insufficient_balance_total{operation="multiplication"} 67`,
+		} {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("expected the metrics to contain %s", expected)
+			}
+		}
 	})
+}
 
-	req, _ := http.NewRequest("DELETE", "/records/1", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+// recordingLimiter records the tokens taken and refuses them when refuse is set
+type recordingLimiter struct {
+	tokens int
+	refuse bool
+}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status OK, got %v", w.Code)
+func (l *recordingLimiter) Take(c *gin.Context, method, route string, tokens int) bool {
+	if method != http.MethodPost || route != "/api/v1/operation" {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
 	}
-
-	// Verify the record has been deleted
-	var record models.Record
-	if err := database.DB.Where("id = ?", 1).First(&record).Error; err == nil {
-		t.Errorf("expected record to be deleted, but found it")
+	if l.refuse {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+		return false
 	}
+
+	l.tokens += tokens
+	return true
+}
+
+// TestPerformBatch_RateLimit tests that the random operations of a batch count against the limit of the operations
+func TestPerformBatch_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	body := `{"operations": [{"operation": "random_string", "length": 5}, {"operation": "addition", "number1": 1, "number2": 2}, {"operation": "random_string", "length": 8}]}`
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		limiter := &recordingLimiter{}
+		operationController := controllers.OperationController{
+			Store:               store,
+			RandomStringService: services.NewSeededRandomStringService(1),
+			RateLimiter:         limiter,
+		}
+
+		router := gin.New()
+		router.POST("/operations/batch", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			operationController.PerformBatch(c)
+		})
+
+		for _, refuse := range []bool{false, true} {
+			limiter.refuse = refuse
+			req, _ := http.NewRequest("POST", "/operations/batch", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// The refused batch isn't performed
+			page, _ := store.Records().List(1, repositories.RecordFilter{}, 10, 0)
+			if refuse {
+				if w.Code != http.StatusTooManyRequests || page.Total != 3 {
+					t.Errorf("expected the refused batch not to be performed, got %v and %d records", w.Code, page.Total)
+				}
+				continue
+			}
+			if w.Code != http.StatusOK || limiter.tokens != 2 || page.Total != 3 {
+				t.Errorf("expected a token for each random operation, got %v, %d tokens and %d records", w.Code, limiter.tokens, page.Total)
+			}
+		}
+	})
 }
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// randomNumberOperations are served by the RandomNumberService
+var randomNumberOperations = map[string]bool{
+	"random_integer": true,
+	"random_decimal": true,
+	"uuid_v4":        true,
+	"uuid_v7":        true,
+	"dice_roll":      true,
+	"shuffle":        true,
+}
+
+// secretPlaceholder replaces the generated passwords and passphrases in the history and in the stored responses of the
+// idempotency keys, the secrets are only sent to the client that requested them
+const secretPlaceholder = "********"
+
+// secretSource generates the passwords and passphrases with crypto/rand, they never go through random.org or the
+// configured provider
+var secretSource services.RandomNumberService = &services.LocalRandomStringService{}
+
+func (i OperationInputs) passwordPolicy() services.PasswordPolicy {
+	length := 16 // Default password length
+	if i.Length != nil {
+		length = *i.Length
+	}
+
+	return services.PasswordPolicy{
+		Length:           length,
+		Classes:          i.Classes,
+		Required:         i.Required,
+		ExcludeAmbiguous: i.ExcludeAmbiguous,
+	}
+}
+
+func (i OperationInputs) passphraseOptions() services.PassphraseOptions {
+	options := services.PassphraseOptions{Words: 6, Separator: "-", Capitalize: i.Capitalize}
+	if i.Words != nil {
+		options.Words = *i.Words
+	}
+	if i.Separator != nil {
+		options.Separator = *i.Separator
+	}
+
+	return options
+}
+
+// secret reports whether the operation generates a secret that must not be stored
+func (r OperationRequest) secret() bool {
+	return r.Operation == "password" || r.Operation == "passphrase"
+}
+
+// entropyBits returns the entropy of the generated secret for the password and passphrase operations
+func (r OperationRequest) entropyBits() (float64, bool) {
+	switch r.Operation {
+	case "password":
+		return r.passwordPolicy().EntropyBits(), true
+	case "passphrase":
+		return r.passphraseOptions().EntropyBits(), true
+	default:
+		return 0, false
+	}
+}
+
+// prepareRandomNumberOperation validates the inputs of a random number operation and returns its cost,
+// which scales with the count for integers and decimals, and the function that performs it with the given source
+func (oc *OperationController) prepareRandomNumberOperation(req OperationRequest, baseCost float64) (float64, func(source services.RandomNumberService) (string, error), error) {
+	if oc.RandomNumberService == nil {
+		return 0, nil, &OperationError{Status: http.StatusInternalServerError, Message: "Random numbers are not available"}
+	}
+
+	count := 1
+	if req.Count != nil {
+		count = *req.Count
+	}
+
+	switch req.Operation {
+	case "random_integer":
+		if req.Min == nil || req.Max == nil {
+			return 0, nil, &OperationError{Status: http.StatusBadRequest, Message: "Both min and max are required for this operation"}
+		}
+		if err := services.ValidateIntegerRange(*req.Min, *req.Max, count); err != nil {
+			return 0, nil, &OperationError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+		return baseCost * float64(count), func(source services.RandomNumberService) (string, error) {
+			integers, err := source.GetRandomIntegers(*req.Min, *req.Max, count)
+			values := make([]string, len(integers))
+			for i, integer := range integers {
+				values[i] = strconv.FormatInt(integer, 10)
+			}
+			return strings.Join(values, "\n"), err
+		}, nil
+	case "random_decimal":
+		decimals := 2 // Default decimal places
+		if req.Decimals != nil {
+			decimals = *req.Decimals
+		}
+		if decimals < 1 || decimals > services.MaxDecimals || count < 1 || count > services.MaxRandomIntegerCount {
+			return 0, nil, &OperationError{Status: http.StatusBadRequest, Message: "decimals must be between 1 and 9 and count between 1 and 10000"}
+		}
+		return baseCost * float64(count), func(source services.RandomNumberService) (string, error) {
+			decimals, err := services.RandomDecimals(source, decimals, count)
+			return strings.Join(decimals, "\n"), err
+		}, nil
+	case "uuid_v4":
+		return baseCost, func(source services.RandomNumberService) (string, error) {
+			return services.UUIDv4(source)
+		}, nil
+	case "uuid_v7":
+		return baseCost, func(source services.RandomNumberService) (string, error) {
+			return services.UUIDv7(source, time.Now())
+		}, nil
+	case "dice_roll":
+		dice, err := services.ParseDice(req.Dice)
+		if err != nil {
+			return 0, nil, &OperationError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+		return baseCost, func(source services.RandomNumberService) (string, error) {
+			return services.RollDice(source, dice)
+		}, nil
+	default: // shuffle
+		if len(req.Items) == 0 || len(req.Items) > services.MaxSequenceLength {
+			return 0, nil, &OperationError{Status: http.StatusBadRequest, Message: "items must have between 1 and 10000 elements"}
+		}
+		return baseCost, func(source services.RandomNumberService) (string, error) {
+			shuffled, err := services.Shuffle(source, req.Items)
+			if err != nil {
+				return "", err
+			}
+			// Items can contain anything, so the result is a JSON array instead of one item per line
+			encoded, err := json.Marshal(shuffled)
+			return string(encoded), err
+		}, nil
+	}
+}
+
+// prepareSecretOperation validates the inputs of a password or passphrase operation and returns the function that
+// generates it with secretSource
+func prepareSecretOperation(req OperationRequest) (func() (string, error), error) {
+	if req.Operation == "password" {
+		policy := req.passwordPolicy()
+		if err := policy.Validate(); err != nil {
+			return nil, &OperationError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+		return func() (string, error) {
+			return services.GeneratePassword(secretSource, policy)
+		}, nil
+	}
+
+	options := req.passphraseOptions()
+	if err := options.Validate(); err != nil {
+		return nil, &OperationError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	return func() (string, error) {
+		return services.GeneratePassphrase(secretSource, options)
+	}, nil
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+	"net/http"
+	"strconv"
+)
+
+type RecordController struct {
+	Records repositories.RecordRepository
+}
+
+func (rc *RecordController) GetRecords(c *gin.Context) {
+	// Get the user ID from the request context (set by the JWT middleware)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	// Apply the filters present in the query string
+	var filter repositories.RecordFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := rc.Records.WithContext(c.Request.Context()).List(userID, filter, limit, offset)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch records"})
+		return
+	}
+	totalPages := (result.Total + int64(limit) - 1) / int64(limit)
+
+	responseRecords := []map[string]interface{}{}
+	for _, record := range result.Records {
+		responseRecord := recordResponse(record)
+		// Full-text matches are sorted by relevance and come with a highlighted snippet
+		if result.Snippets != nil {
+			responseRecord["snippet"] = result.Snippets[record.ID]
+		}
+		responseRecords = append(responseRecords, responseRecord)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"records":    responseRecords,
+		"totalPages": totalPages,
+	})
+}
+
+func (rc *RecordController) DeleteRecord(c *gin.Context) {
+	// Get the user ID from the request context (set by the JWT middleware)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get the record ID from the URL parameter
+	recordID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	if err := rc.Records.WithContext(c.Request.Context()).Delete(userID, uint(recordID)); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete record"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Record deleted successfully"})
+}
+
+type UpdateRecordRequest struct {
+	Note *string  `json:"note"`
+	Tags []string `json:"tags"` // replaces the current tags when present, an empty list removes them all
+}
+
+// UpdateRecord edits the note and tags of one of the authenticated user's records
+func (rc *RecordController) UpdateRecord(c *gin.Context) {
+	// Get the user ID from the request context (set by the JWT middleware)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req UpdateRecordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record, err := findUserRecord(rc.Records.WithContext(c.Request.Context()), userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	if err := rc.Records.WithContext(c.Request.Context()).Annotate(&record, req.Note, req.Tags); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update record"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recordResponse(record))
+}
+
+// recordResponse is the representation of a record returned by the records endpoints
+func recordResponse(record models.Record) map[string]interface{} {
+	tags := []string{}
+	for _, tag := range record.Tags {
+		tags = append(tags, tag.Name)
+	}
+
+	return map[string]interface{}{
+		"id":        record.ID,
+		"amount":    record.Amount,
+		"date":      record.Date,
+		"result":    record.OperationResult,
+		"operation": record.Operation.Type,
+		"note":      record.Note,
+		"tags":      tags,
+	}
+}
+
+// maxBulkDeleteIDs limits the IDs of a bulk delete, they all go into a single query
+const maxBulkDeleteIDs = 1000
+
+type BulkDeleteRequest struct {
+	IDs    []uint                    `json:"ids"`
+	Filter repositories.RecordFilter `json:"filter"`
+}
+
+// BulkDeleteRecords deletes either the given record IDs or every record matching the filter,
+// always scoped to the authenticated user
+func (rc *RecordController) BulkDeleteRecords(c *gin.Context) {
+	// Get the user ID from the request context (set by the JWT middleware)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req BulkDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Refuse to wipe the whole history by accident
+	if len(req.IDs) == 0 && req.Filter.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either ids or a filter is required"})
+		return
+	}
+	if len(req.IDs) > maxBulkDeleteIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d ids can be deleted at once", maxBulkDeleteIDs)})
+		return
+	}
+
+	deleted, err := rc.Records.WithContext(c.Request.Context()).DeleteMatching(userID, req.IDs, req.Filter)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete records"})
+		return
+	}
+
+	found := make(map[uint]bool, len(deleted))
+	for _, id := range deleted {
+		found[id] = true
+	}
+	notFound := []uint{}
+	for _, id := range req.IDs {
+		if !found[id] {
+			notFound = append(notFound, id)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deleted":  len(deleted),
+		"notFound": notFound,
+	})
+}
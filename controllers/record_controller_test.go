@@ -0,0 +1,239 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/controllers"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+)
+
+func TestBulkDeleteRecords_ByIDs(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		recordController := &controllers.RecordController{Records: store.Records()}
+
+		// Two records for the test user and one for somebody else
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "8"})
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "9"})
+		store.Records().Create(&models.Record{UserID: 2, OperationID: 1, OperationResult: "10"})
+
+		router := gin.Default()
+		router.POST("/records/bulk-delete", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			recordController.BulkDeleteRecords(c)
+		})
+
+		jsonBody := `{"ids": [1, 2, 3, 42]}`
+		req, _ := http.NewRequest("POST", "/records/bulk-delete", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		var response struct {
+			Deleted  int64  `json:"deleted"`
+			NotFound []uint `json:"notFound"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+
+		if response.Deleted != 2 {
+			t.Errorf("expected 2 deleted records, got %d", response.Deleted)
+		}
+		if len(response.NotFound) != 2 || response.NotFound[0] != 3 || response.NotFound[1] != 42 {
+			t.Errorf("expected not found ids [3 42], got %v", response.NotFound)
+		}
+
+		// The other user's record must survive
+		if _, err := store.Records().FindForUser(2, 3); err != nil {
+			t.Errorf("expected record of another user to be kept, but got error: %v", err)
+		}
+	})
+}
+
+func TestBulkDeleteRecords_ByFilter(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		recordController := &controllers.RecordController{Records: store.Records()}
+
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "123"})
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "456"})
+
+		router := gin.Default()
+		router.POST("/records/bulk-delete", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			recordController.BulkDeleteRecords(c)
+		})
+
+		jsonBody := `{"filter": {"search": "12"}}`
+		req, _ := http.NewRequest("POST", "/records/bulk-delete", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		page, _ := store.Records().List(1, repositories.RecordFilter{}, 10, 0)
+		if page.Total != 1 {
+			t.Errorf("expected 1 remaining record, got %d", page.Total)
+		}
+
+		// An empty request must not delete anything
+		req, _ = http.NewRequest("POST", "/records/bulk-delete", bytes.NewBuffer([]byte(`{}`)))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request, got %v", w.Code)
+		}
+	})
+}
+
+func TestBulkDeleteRecords_TooManyIDs(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		recordController := &controllers.RecordController{Records: store.Records()}
+
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "123"})
+
+		router := gin.Default()
+		router.POST("/records/bulk-delete", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			recordController.BulkDeleteRecords(c)
+		})
+
+		ids := make([]uint, 1001)
+		for i := range ids {
+			ids[i] = uint(i + 1)
+		}
+		jsonBody, _ := json.Marshal(controllers.BulkDeleteRequest{IDs: ids})
+		req, _ := http.NewRequest("POST", "/records/bulk-delete", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request, got %v", w.Code)
+		}
+
+		page, _ := store.Records().List(1, repositories.RecordFilter{}, 10, 0)
+		if page.Total != 1 {
+			t.Errorf("expected the record to be kept, got %d records", page.Total)
+		}
+	})
+}
+
+func TestUpdateRecord_TagsAndNote(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		recordController := &controllers.RecordController{Records: store.Records()}
+
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "8"})
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "9"})
+
+		router := gin.Default()
+		router.PATCH("/records/:id", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			recordController.UpdateRecord(c)
+		})
+		router.GET("/records", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			recordController.GetRecords(c)
+		})
+
+		jsonBody := `{"note": "Q3 invoice check", "tags": ["invoices", " q3 ", "invoices"]}`
+		req, _ := http.NewRequest("PATCH", "/records/1", bytes.NewBuffer([]byte(jsonBody)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		var record struct {
+			Note string   `json:"note"`
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+		if record.Note != "Q3 invoice check" {
+			t.Errorf("expected note to be updated, got %q", record.Note)
+		}
+		if len(record.Tags) != 2 {
+			t.Errorf("expected 2 tags, got %v", record.Tags)
+		}
+
+		// Only the tagged record is returned when filtering by tag
+		req, _ = http.NewRequest("GET", "/records?tag=q3", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Records []map[string]interface{} `json:"records"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+		if len(response.Records) != 1 || response.Records[0]["result"] != "8" {
+			t.Errorf("expected only the tagged record, got %v", response.Records)
+		}
+	})
+}
+
+func TestGetRecords_Search(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		recordController := &controllers.RecordController{Records: store.Records()}
+
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "8", Inputs: `{"number1":5,"number2":3}`, Note: "invoice check"})
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "9", Inputs: `{"number1":5,"number2":4}`})
+		deleted := models.Record{UserID: 1, OperationID: 1, OperationResult: "10", Note: "invoice draft"}
+		store.Records().Create(&deleted)
+		store.Records().Delete(1, deleted.ID)
+
+		router := gin.Default()
+		router.GET("/records", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			recordController.GetRecords(c)
+		})
+
+		// The note is searchable and deleted records are not returned
+		req, _ := http.NewRequest("GET", "/records?search=invoice", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		var response struct {
+			Records []map[string]interface{} `json:"records"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+		if len(response.Records) != 1 || response.Records[0]["result"] != "8" {
+			t.Fatalf("expected only the annotated record, got %v", response.Records)
+		}
+	})
+}
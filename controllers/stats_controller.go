@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+	"net/http"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+type StatsController struct {
+	Users   repositories.UserRepository
+	Records repositories.RecordRepository
+}
+
+// GetStats returns the usage statistics of the authenticated user, or of every user when an admin asks for scope=all.
+// The optional from and to parameters (YYYY-MM-DD, both inclusive) limit the date range
+func (sc *StatsController) GetStats(c *gin.Context) {
+	// Get the user ID from the request context (set by the JWT middleware)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	user, err := sc.Users.WithContext(c.Request.Context()).FindByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	scope := c.DefaultQuery("scope", "user")
+	if scope != "user" && scope != "all" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be either user or all"})
+		return
+	}
+	if scope == "all" && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can see the statistics of all users"})
+		return
+	}
+
+	var query repositories.StatsQuery
+	if scope == "user" {
+		query.UserID = user.ID
+	}
+
+	if from := c.Query("from"); from != "" {
+		fromDate, err := time.Parse(dateLayout, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date formatted as YYYY-MM-DD"})
+			return
+		}
+		query.From = fromDate
+	}
+
+	if to := c.Query("to"); to != "" {
+		toDate, err := time.Parse(dateLayout, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date formatted as YYYY-MM-DD"})
+			return
+		}
+		query.To = toDate.AddDate(0, 0, 1)
+	}
+
+	entries, err := sc.Records.WithContext(c.Request.Context()).StatsEntries(query)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scope": scope,
+		"stats": services.ComputeUsageStats(entries),
+	})
+}
@@ -0,0 +1,74 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/controllers"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+)
+
+func TestGetStats(t *testing.T) {
+	t.Parallel()
+
+	runWithStores(t, func(t *testing.T, store repositories.Store) {
+		statsController := &controllers.StatsController{Users: store.Users(), Records: store.Records()}
+
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 1, Amount: 1, UserBalance: 99})
+		store.Records().Create(&models.Record{UserID: 1, OperationID: 4, Amount: 2, UserBalance: 97})
+		store.Records().Create(&models.Record{UserID: 2, OperationID: 4, Amount: 2, UserBalance: 48})
+
+		router := gin.Default()
+		router.GET("/stats", func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			statsController.GetStats(c)
+		})
+
+		req, _ := http.NewRequest("GET", "/stats?from=2000-01-01", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", w.Code)
+		}
+
+		var response struct {
+			Stats struct {
+				TotalOperations int     `json:"totalOperations"`
+				TotalSpent      float64 `json:"totalSpent"`
+			} `json:"stats"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+		if response.Stats.TotalOperations != 2 || response.Stats.TotalSpent != 3 {
+			t.Errorf("expected only the user's records in the stats, got %+v", response.Stats)
+		}
+
+		// Only admins can see every user's statistics
+		req, _ = http.NewRequest("GET", "/stats?scope=all", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected status Forbidden, got %v", w.Code)
+		}
+
+		admin, _ := store.Users().FindByID(1)
+		admin.Role = models.RoleAdmin
+		store.Users().Save(&admin)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+		if response.Stats.TotalOperations != 3 {
+			t.Errorf("expected the records of every user in the stats, got %+v", response.Stats)
+		}
+	})
+}
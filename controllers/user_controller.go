@@ -5,22 +5,34 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/metrics"
 	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func RegisterUser(c *gin.Context) {
+// UserController registers users and signs their login tokens
+type UserController struct {
+	Users      repositories.UserRepository
+	JWTSecret  []byte
+	BcryptCost int
+	Metrics    *metrics.Metrics // optional
+}
+
+func (uc *UserController) RegisterUser(c *gin.Context) {
 	var input models.User
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), 14)
+	// The role can't be chosen when registering
+	input.Role = models.RoleUser
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), uc.BcryptCost)
 	input.Password = string(hashedPassword)
 
-	if err := database.DB.Create(&input).Error; err != nil {
+	if err := uc.Users.WithContext(c.Request.Context()).Create(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -28,21 +40,22 @@ func RegisterUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
 }
 
-func LoginUser(c *gin.Context) {
+func (uc *UserController) LoginUser(c *gin.Context) {
 	var input models.User
-	var user models.User
-
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := database.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
+	user, err := uc.Users.WithContext(c.Request.Context()).FindByUsername(input.Username)
+	if err != nil {
+		uc.Metrics.ObserveLogin(false)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		uc.Metrics.ObserveLogin(false)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
@@ -52,11 +65,13 @@ func LoginUser(c *gin.Context) {
 		"user_id": user.ID,
 	})
 
-	tokenString, err := token.SignedString([]byte("secret"))
+	tokenString, err := token.SignedString(uc.JWTSecret)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
+	uc.Metrics.ObserveLogin(true)
 	c.JSON(http.StatusOK, gin.H{"token": tokenString})
 }
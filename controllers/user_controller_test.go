@@ -3,26 +3,29 @@ package controllers
 import (
 	"bytes"
 	"github.com/gin-gonic/gin"
-	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/database/testdb"
 	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 )
 
-// setupTestDatabase initializes an in-memory database and seeds data.
-func setupTestDatabase() {
-	// Initialize the in-memory database
-	database.ConnectDatabase(":memory:")
-
-	// Seed initial data for the tests
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
-	database.DB.Create(&models.User{
-		Username: "testuser@example.com",
-		Password: string(hashedPassword),
-		Status:   "active",
-		Balance:  100.0,
+// runWithUserController runs the test on every store, see testdb.Run, with a controller backed by a store with a test
+// user. It signs tokens with a test secret and hashes passwords with the minimum cost to keep tests fast
+func runWithUserController(t *testing.T, test func(t *testing.T, userController *UserController)) {
+	testdb.Run(t, func(t *testing.T, store repositories.Store) {
+		// Seed initial data for the tests
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		store.Users().Create(&models.User{
+			Username: "testuser@example.com",
+			Password: string(hashedPassword),
+			Status:   "active",
+			Balance:  100.0,
+		})
+
+		test(t, &UserController{Users: store.Users(), JWTSecret: []byte("test-secret"), BcryptCost: bcrypt.MinCost})
 	})
 }
 
@@ -43,52 +46,57 @@ func performRequest(router *gin.Engine, method, path string, body []byte) *httpt
 }
 
 func TestRegisterUser(t *testing.T) {
-	setupTestDatabase()
+	t.Parallel()
 
-	// Set up a new router with the /register route
-	router := setupRouter(func(r *gin.Engine) {
-		r.POST("/register", RegisterUser)
-	})
+	runWithUserController(t, func(t *testing.T, userController *UserController) {
+
+		// Set up a new router with the /register route
+		router := setupRouter(func(r *gin.Engine) {
+			r.POST("/register", userController.RegisterUser)
+		})
 
-	// Test a successful user registration
-	jsonBody := `{"username": "newuser@example.com", "password": "password123"}`
-	w := performRequest(router, "POST", "/register", []byte(jsonBody))
+		// Test a successful user registration
+		jsonBody := `{"username": "newuser@example.com", "password": "password123"}`
+		w := performRequest(router, "POST", "/register", []byte(jsonBody))
 
-	// Check if the response is OK (200)
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status OK, got %v", w.Code)
-	}
+		// Check if the response is OK (200)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status OK, got %v", w.Code)
+		}
 
-	// Verify user was added to the in-memory database
-	var user models.User
-	if err := database.DB.Where("username = ?", "newuser@example.com").First(&user).Error; err != nil {
-		t.Errorf("expected user to be created, but got error: %v", err)
-	}
+		// Verify user was added to the store
+		if _, err := userController.Users.FindByUsername("newuser@example.com"); err != nil {
+			t.Errorf("expected user to be created, but got error: %v", err)
+		}
+	})
 }
 
 func TestLoginUser(t *testing.T) {
-	setupTestDatabase()
+	t.Parallel()
 
-	// Set up a new router with the /login route
-	router := setupRouter(func(r *gin.Engine) {
-		r.POST("/login", LoginUser)
-	})
+	runWithUserController(t, func(t *testing.T, userController *UserController) {
+
+		// Set up a new router with the /login route
+		router := setupRouter(func(r *gin.Engine) {
+			r.POST("/login", userController.LoginUser)
+		})
 
-	// Test a successful login request
-	jsonBody := `{"username": "testuser@example.com", "password": "password123"}`
-	w := performRequest(router, "POST", "/login", []byte(jsonBody))
+		// Test a successful login request
+		jsonBody := `{"username": "testuser@example.com", "password": "password123"}`
+		w := performRequest(router, "POST", "/login", []byte(jsonBody))
 
-	// Check if the response status is OK (200)
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status OK, got %v", w.Code)
-	}
+		// Check if the response status is OK (200)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status OK, got %v", w.Code)
+		}
 
-	// Test a failed login request with incorrect credentials
-	wrongJsonBody := `{"username": "testuser@example.com", "password": "wrongpassword"}`
-	wrongW := performRequest(router, "POST", "/login", []byte(wrongJsonBody))
+		// Test a failed login request with incorrect credentials
+		wrongJsonBody := `{"username": "testuser@example.com", "password": "wrongpassword"}`
+		wrongW := performRequest(router, "POST", "/login", []byte(wrongJsonBody))
 
-	// Check if the response status is Unauthorized (401)
-	if wrongW.Code != http.StatusUnauthorized {
-		t.Errorf("expected status Unauthorized, got %v", wrongW.Code)
-	}
+		// Check if the response status is Unauthorized (401)
+		if wrongW.Code != http.StatusUnauthorized {
+			t.Errorf("expected status Unauthorized, got %v", wrongW.Code)
+		}
+	})
 }
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/logging"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is the duration above which queries are logged as warnings
+const slowQueryThreshold = 200 * time.Millisecond
+
+// slogLogger writes GORM's logs with slog, using the logger of the context when the query has one.
+// Failed queries are errors, slow ones warnings, and every query is logged at the debug level.
+// The SQL is logged without its values, which include password hashes, generated passwords and results
+type slogLogger struct {
+	// translator turns the errors of the driver into GORM's, to recognize the expected constraint violations
+	translator gorm.ErrorTranslator
+}
+
+func (l slogLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	// The level is the one of the slog handler
+	return l
+}
+
+func (l slogLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	logging.FromContext(ctx).InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l slogLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	logging.FromContext(ctx).WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l slogLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	logging.FromContext(ctx).ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+// ParamsFilter leaves the values out of the SQL passed to Trace, the placeholders are logged instead
+func (l slogLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// translate returns GORM's error for a driver error, e.g. gorm.ErrDuplicatedKey
+func (l slogLogger) translate(err error) error {
+	if l.translator == nil {
+		return err
+	}
+
+	return l.translator.Translate(err)
+}
+
+func (l slogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	logger := logging.FromContext(ctx)
+	elapsed := time.Since(begin)
+
+	level, message := slog.LevelDebug, "query"
+	switch {
+	// Duplicates are expected, e.g. a taken username. The driver's message is replaced since MySQL's has the value
+	case err != nil && errors.Is(l.translate(err), gorm.ErrDuplicatedKey):
+		level, message, err = slog.LevelInfo, "query violated a unique constraint", gorm.ErrDuplicatedKey
+	// So are missing rows, e.g. when checking that a username is free
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, message = slog.LevelError, "query failed"
+	case elapsed > slowQueryThreshold:
+		level, message = slog.LevelWarn, "slow query"
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attributes := []any{"sql", sql, "rows", rows, "duration_ms", float64(elapsed.Microseconds()) / 1000}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		attributes = append(attributes, "error", err)
+	}
+	logger.Log(ctx, level, message, attributes...)
+}
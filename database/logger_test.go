@@ -0,0 +1,54 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/database/testdb"
+	"github.com/ricardofabila/arithmetic-calculator-backend/logging"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+)
+
+// TestQueryLogger tests that the queries are logged without their values and that a taken username isn't an error
+func TestQueryLogger(t *testing.T) {
+	for _, backend := range testdb.Backends() {
+		t.Run(backend, func(t *testing.T) {
+			users := testdb.Open(t, backend).Store().Users()
+
+			var output bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			ctx := logging.WithLogger(context.Background(), logger)
+
+			secret := "$2a$14$secret-password-hash"
+			if err := users.WithContext(ctx).Create(&models.User{Username: "taken@example.com", Password: secret}); err != nil {
+				t.Fatalf("unexpected error creating the user: %v", err)
+			}
+			if err := users.WithContext(ctx).Create(&models.User{Username: "taken@example.com", Password: secret}); err == nil {
+				t.Fatal("expected an error for a duplicated username, but got nil")
+			}
+
+			if strings.Contains(output.String(), secret) {
+				t.Errorf("expected the values to be left out of the logs, got %s", output.String())
+			}
+
+			levels := map[string]int{}
+			for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+				var entry struct {
+					Level string `json:"level"`
+					SQL   string `json:"sql"`
+				}
+				json.Unmarshal([]byte(line), &entry)
+				if strings.HasPrefix(entry.SQL, "INSERT INTO") {
+					levels[entry.Level]++
+				}
+			}
+			if levels["DEBUG"] != 1 || levels["INFO"] != 1 || levels["ERROR"] != 0 {
+				t.Errorf("expected the inserts to be logged at the debug and info levels, got %v in %s", levels, output.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The migrations of every dialect are in migrations/<dialect>/<version>_<name>.up.sql with the matching .down.sql.
+// Statements are separated by a semicolon at the end of a line
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaOutdated is returned by CheckSchema when the database doesn't match the migrations of this version
+var ErrSchemaOutdated = errors.New("the database schema is out of date")
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// addColumn matches the statements adding a column and captures the table and the column
+var addColumn = regexp.MustCompile("(?i)^ALTER\\s+TABLE\\s+[`\"]?(\\w+)[`\"]?\\s+ADD\\s+COLUMN\\s+[`\"]?(\\w+)[`\"]?")
+
+// Migration is a versioned change of the schema and how to revert it
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is a migration and whether it was applied to the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// LoadMigrations returns the migrations of the dialect sorted by version
+func LoadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s: %w", dialect, err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.up = string(contents)
+		} else {
+			migration.down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// statements splits a migration file into its statements, skipping the comment lines
+func statements(script string) []string {
+	var result []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			result = append(result, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		result = append(result, strings.TrimSpace(current.String()))
+	}
+
+	return result
+}
+
+// createMigrationsTable creates the table that keeps track of the applied migrations
+func (c *Connection) createMigrationsTable() error {
+	return c.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`).Error
+}
+
+// appliedMigrations returns the applied migrations by version
+func (c *Connection) appliedMigrations() (map[int]appliedMigration, error) {
+	if err := c.createMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	return readAppliedMigrations(c.DB)
+}
+
+// readAppliedMigrations returns the applied migrations by version without creating the table, none were applied
+// when it doesn't exist
+func readAppliedMigrations(db *gorm.DB) (map[int]appliedMigration, error) {
+	if !db.Migrator().HasTable("schema_migrations") {
+		return map[int]appliedMigration{}, db.Statement.Context.Err()
+	}
+
+	var rows []appliedMigration
+	if err := db.Table("schema_migrations").Order("version").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return applied, nil
+}
+
+// run executes a migration file and records the change in schema_migrations within a transaction.
+// MySQL commits DDL statements implicitly, so a migration that fails halfway there has to be fixed by hand.
+// Columns that already exist are not added again: the databases created by AutoMigrate before the migrations were
+// introduced have the columns of the models of their version, which may be newer than the initial schema
+func (c *Connection) run(script string, record func(tx *gorm.DB) error) error {
+	return c.DB.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements(script) {
+			if match := addColumn.FindStringSubmatch(statement); match != nil && tx.Migrator().HasColumn(match[1], match[2]) {
+				continue
+			}
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		return record(tx)
+	})
+}
+
+// Migrate applies the pending migrations in order and returns them
+func (c *Connection) Migrate() ([]Migration, error) {
+	migrations, err := LoadMigrations(c.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := c.run(migration.up, func(tx *gorm.DB) error {
+			return tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, time.Now().UTC()).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Rollback reverts the last applied migrations, up to steps of them, and returns them
+func (c *Connection) Rollback(steps int) ([]Migration, error) {
+	migrations, err := LoadMigrations(c.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := c.run(migration.down, func(tx *gorm.DB) error {
+			return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback of %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// MigrationStatus returns every migration and whether it was applied
+func (c *Connection) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations(c.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		row, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: row.AppliedAt}
+	}
+
+	return statuses, nil
+}
+
+// CheckSchema returns ErrSchemaOutdated when a migration is pending, or when the database was migrated by a newer
+// version that has migrations this one doesn't know about. It only reads the database, with ctx
+func (c *Connection) CheckSchema(ctx context.Context) error {
+	migrations, err := LoadMigrations(c.Dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := readAppliedMigrations(c.DB.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		if _, ok := applied[migration.Version]; !ok {
+			return fmt.Errorf("%w: migration %04d_%s is pending", ErrSchemaOutdated, migration.Version, migration.Name)
+		}
+	}
+	for version, row := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: migration %04d_%s is unknown to this version", ErrSchemaOutdated, version, row.Name)
+		}
+	}
+
+	return nil
+}
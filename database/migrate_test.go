@@ -0,0 +1,182 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/database/testdb"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"gorm.io/gorm"
+)
+
+// TestMain stops the embedded PostgreSQL server once the tests are done, see testdb.Main
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m))
+}
+
+// TestMigrations tests rolling back and applying the migrations on every backend
+func TestMigrations(t *testing.T) {
+	for _, backend := range testdb.Backends() {
+		t.Run(backend, func(t *testing.T) {
+			connection := testdb.Open(t, backend)
+			if err := connection.CheckSchema(context.Background()); err != nil {
+				t.Fatalf("expected the migrated schema to be up to date, got %v", err)
+			}
+
+			migrations, err := database.LoadMigrations(connection.Dialect)
+			if err != nil || len(migrations) == 0 {
+				t.Fatalf("expected the migrations of %s, got %v, %v", backend, migrations, err)
+			}
+
+			reverted, err := connection.Rollback(len(migrations))
+			if err != nil || len(reverted) != len(migrations) {
+				t.Fatalf("expected every migration to be reverted, got %v, %v", reverted, err)
+			}
+			if connection.DB.Migrator().HasTable("records") {
+				t.Error("expected the records table to be dropped")
+			}
+			if err := connection.CheckSchema(context.Background()); !errors.Is(err, database.ErrSchemaOutdated) {
+				t.Errorf("expected ErrSchemaOutdated, got %v", err)
+			}
+
+			statuses, _ := connection.MigrationStatus()
+			if len(statuses) != len(migrations) || statuses[0].Applied {
+				t.Errorf("expected every migration to be pending, got %+v", statuses)
+			}
+
+			applied, err := connection.Migrate()
+			if err != nil || len(applied) != len(migrations) {
+				t.Fatalf("expected every migration to be applied, got %v, %v", applied, err)
+			}
+			if applied, _ := connection.Migrate(); len(applied) != 0 {
+				t.Errorf("expected nothing left to apply, got %v", applied)
+			}
+
+			statuses, _ = connection.MigrationStatus()
+			if !statuses[0].Applied || statuses[0].AppliedAt.IsZero() {
+				t.Errorf("expected the migration to be applied, got %+v", statuses[0])
+			}
+		})
+	}
+}
+
+// TestCheckSchema_ReadOnly tests that checking a database that was never migrated doesn't create anything, and that
+// the check gives up with its context
+func TestCheckSchema_ReadOnly(t *testing.T) {
+	connection, err := database.Connect(":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error connecting: %v", err)
+	}
+	defer connection.Close()
+
+	if err := connection.CheckSchema(context.Background()); !errors.Is(err, database.ErrSchemaOutdated) {
+		t.Errorf("expected ErrSchemaOutdated, got %v", err)
+	}
+	if connection.DB.Migrator().HasTable("schema_migrations") {
+		t.Error("expected the check not to create the schema_migrations table")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := connection.CheckSchema(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled check to fail with context.Canceled, got %v", err)
+	}
+}
+
+// The models of the first version, which created its tables with AutoMigrate
+type baselineUser struct {
+	gorm.Model
+	Username string  `gorm:"unique;not null"`
+	Password string  `gorm:"not null"`
+	Status   string  `gorm:"default:active"`
+	Balance  float64 `gorm:"default:50"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineOperation struct {
+	ID   uint    `gorm:"primaryKey"`
+	Type string  `gorm:"unique;not null"`
+	Cost float64 `gorm:"not null"`
+}
+
+func (baselineOperation) TableName() string { return "operations" }
+
+type baselineRecord struct {
+	gorm.Model
+	OperationID     uint
+	UserID          uint
+	Amount          float64
+	UserBalance     float64
+	OperationResult string
+	Date            string
+	Operation       baselineOperation `gorm:"foreignKey:OperationID"`
+}
+
+func (baselineRecord) TableName() string { return "records" }
+
+// TestMigrate_ExistingSchema tests that a database created by AutoMigrate before the migrations is adopted and gets
+// the columns and tables added since, whether it was created by the first version or by a later one
+func TestMigrate_ExistingSchema(t *testing.T) {
+	tests := map[string][]interface{}{
+		"baseline":       {&baselineUser{}, &baselineOperation{}, &baselineRecord{}},
+		"before release": {&models.User{}, &models.Operation{}, &models.Record{}, &models.Tag{}},
+	}
+
+	for name, existing := range tests {
+		t.Run(name, func(t *testing.T) {
+			connection, err := database.Connect(":memory:")
+			if err != nil {
+				t.Fatalf("unexpected error connecting to the database: %v", err)
+			}
+			defer connection.Close()
+
+			if err := connection.DB.AutoMigrate(existing...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			connection.DB.Exec("INSERT INTO users (username, password, balance) VALUES (?, ?, ?)", "existing@example.com", "password123", 50)
+
+			if _, err := connection.Migrate(); err != nil {
+				t.Fatalf("unexpected error migrating the existing schema: %v", err)
+			}
+			if err := connection.CheckSchema(context.Background()); err != nil {
+				t.Fatalf("expected the migrated schema to be up to date, got %v", err)
+			}
+			connection.EnableFullTextSearch()
+
+			store := connection.Store()
+			existingUser, err := store.Users().FindByUsername("existing@example.com")
+			if err != nil || existingUser.Role != models.RoleUser {
+				t.Errorf("expected the existing user to be kept with the default role, got %+v, %v", existingUser, err)
+			}
+
+			// Every column of the current models can be written
+			if err := database.SeedOperations(store.Operations()); err != nil {
+				t.Fatalf("unexpected error seeding operations: %v", err)
+			}
+			user := models.User{Username: "new@example.com", Password: "password123"}
+			if err := store.Users().Create(&user); err != nil {
+				t.Fatalf("unexpected error creating a user: %v", err)
+			}
+			tags, err := store.Records().FindOrCreateTags(user.ID, []string{"invoices"})
+			if err != nil {
+				t.Fatalf("unexpected error creating tags: %v", err)
+			}
+			record := models.Record{OperationID: 1, UserID: user.ID, OperationResult: "3", Inputs: `{"number1":1,"number2":2}`, Note: "check", Tags: tags}
+			if err := store.Records().Create(&record); err != nil {
+				t.Fatalf("unexpected error creating a record: %v", err)
+			}
+			if err := store.IdempotencyKeys().Create(&models.IdempotencyKey{UserID: user.ID, Key: "key", RequestHash: "hash", RecordID: record.ID}); err != nil {
+				t.Fatalf("unexpected error creating an idempotency key: %v", err)
+			}
+
+			found, err := store.Records().FindForUser(user.ID, record.ID)
+			if err != nil || found.Note != "check" || found.Inputs != record.Inputs || len(found.Tags) != 1 {
+				t.Errorf("expected the record with its note, inputs and tags, got %+v, %v", found, err)
+			}
+		})
+	}
+}
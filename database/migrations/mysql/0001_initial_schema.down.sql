@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `records`;
+DROP TABLE IF EXISTS `operations`;
+DROP TABLE IF EXISTS `users`;
@@ -0,0 +1,40 @@
+-- The schema of the first version, which created its tables with GORM's AutoMigrate, existing databases keep their
+-- tables. The columns and tables added since are created by the following migrations.
+-- MySQL has no CREATE INDEX IF NOT EXISTS, so the indexes are declared with the tables
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  `username` varchar(255) NOT NULL,
+  `password` longtext NOT NULL,
+  `status` varchar(32) DEFAULT 'active',
+  `balance` double DEFAULT 50,
+  PRIMARY KEY (`id`),
+  KEY `idx_users_deleted_at` (`deleted_at`),
+  UNIQUE KEY `uni_users_username` (`username`)
+);
+
+CREATE TABLE IF NOT EXISTS `operations` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `type` varchar(64) NOT NULL,
+  `cost` double NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uni_operations_type` (`type`)
+);
+
+CREATE TABLE IF NOT EXISTS `records` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3),
+  `updated_at` datetime(3),
+  `deleted_at` datetime(3),
+  `operation_id` bigint unsigned,
+  `user_id` bigint unsigned,
+  `amount` double,
+  `user_balance` double,
+  `operation_result` longtext,
+  `date` longtext,
+  PRIMARY KEY (`id`),
+  KEY `idx_records_deleted_at` (`deleted_at`),
+  CONSTRAINT `fk_records_operation` FOREIGN KEY (`operation_id`) REFERENCES `operations` (`id`)
+);
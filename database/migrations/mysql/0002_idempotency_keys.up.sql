@@ -0,0 +1,12 @@
+CREATE TABLE `idempotency_keys` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3),
+  `user_id` bigint unsigned NOT NULL,
+  `idempotency_key` varchar(255) NOT NULL,
+  `request_hash` varchar(64) NOT NULL,
+  `record_id` bigint unsigned,
+  `status_code` bigint,
+  `response` longtext,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_idempotency_keys_user_key` (`user_id`, `idempotency_key`)
+);
@@ -0,0 +1 @@
+ALTER TABLE `users` ADD COLUMN `role` varchar(32) DEFAULT 'user';
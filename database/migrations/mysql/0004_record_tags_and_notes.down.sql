@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `record_tags`;
+DROP TABLE IF EXISTS `tags`;
+ALTER TABLE `records` DROP COLUMN `note`;
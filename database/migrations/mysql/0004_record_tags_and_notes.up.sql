@@ -0,0 +1,17 @@
+ALTER TABLE `records` ADD COLUMN `note` longtext;
+
+CREATE TABLE IF NOT EXISTS `tags` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_tags_user_name` (`user_id`, `name`)
+);
+
+CREATE TABLE IF NOT EXISTS `record_tags` (
+  `record_id` bigint unsigned NOT NULL,
+  `tag_id` bigint unsigned NOT NULL,
+  PRIMARY KEY (`record_id`, `tag_id`),
+  CONSTRAINT `fk_record_tags_record` FOREIGN KEY (`record_id`) REFERENCES `records` (`id`),
+  CONSTRAINT `fk_record_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags` (`id`)
+);
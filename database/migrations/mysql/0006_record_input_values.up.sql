@@ -0,0 +1,3 @@
+-- The values of the inputs are searched instead of their JSON, the existing records are filled in at startup, see
+-- BackfillInputValues
+ALTER TABLE `records` ADD COLUMN `input_values` longtext;
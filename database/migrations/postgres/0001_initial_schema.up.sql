@@ -0,0 +1,36 @@
+-- The schema of the first version, which created its tables with GORM's AutoMigrate, existing databases keep their
+-- tables. The columns and tables added since are created by the following migrations
+CREATE TABLE IF NOT EXISTS "users" (
+  "id" bigserial PRIMARY KEY,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "username" varchar(255) NOT NULL,
+  "password" text NOT NULL,
+  "status" varchar(32) DEFAULT 'active',
+  "balance" decimal DEFAULT 50,
+  CONSTRAINT "uni_users_username" UNIQUE ("username")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "operations" (
+  "id" bigserial PRIMARY KEY,
+  "type" varchar(64) NOT NULL,
+  "cost" decimal NOT NULL,
+  CONSTRAINT "uni_operations_type" UNIQUE ("type")
+);
+
+CREATE TABLE IF NOT EXISTS "records" (
+  "id" bigserial PRIMARY KEY,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "operation_id" bigint,
+  "user_id" bigint,
+  "amount" decimal,
+  "user_balance" decimal,
+  "operation_result" text,
+  "date" text,
+  CONSTRAINT "fk_records_operation" FOREIGN KEY ("operation_id") REFERENCES "operations" ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_records_deleted_at" ON "records" ("deleted_at");
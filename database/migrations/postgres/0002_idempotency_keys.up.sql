@@ -0,0 +1,11 @@
+CREATE TABLE "idempotency_keys" (
+  "id" bigserial PRIMARY KEY,
+  "created_at" timestamptz,
+  "user_id" bigint NOT NULL,
+  "idempotency_key" varchar(255) NOT NULL,
+  "request_hash" varchar(64) NOT NULL,
+  "record_id" bigint,
+  "status_code" bigint,
+  "response" text
+);
+CREATE UNIQUE INDEX "idx_idempotency_keys_user_key" ON "idempotency_keys" ("user_id", "idempotency_key");
@@ -0,0 +1,16 @@
+ALTER TABLE "records" ADD COLUMN "note" text;
+
+CREATE TABLE IF NOT EXISTS "tags" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "name" varchar(255) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_tags_user_name" ON "tags" ("user_id", "name");
+
+CREATE TABLE IF NOT EXISTS "record_tags" (
+  "record_id" bigint,
+  "tag_id" bigint,
+  PRIMARY KEY ("record_id", "tag_id"),
+  CONSTRAINT "fk_record_tags_record" FOREIGN KEY ("record_id") REFERENCES "records" ("id"),
+  CONSTRAINT "fk_record_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags" ("id")
+);
@@ -0,0 +1,5 @@
+-- The full-text search index is created at startup when FTS5 is available, see SetupFullTextSearch
+DROP TABLE IF EXISTS `records_fts`;
+DROP TABLE IF EXISTS `records`;
+DROP TABLE IF EXISTS `operations`;
+DROP TABLE IF EXISTS `users`;
@@ -0,0 +1,9 @@
+-- The schema of the first version, which created its tables with GORM's AutoMigrate, existing databases keep their
+-- tables. The columns and tables added since are created by the following migrations
+CREATE TABLE IF NOT EXISTS `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`username` text NOT NULL,`password` text NOT NULL,`status` text DEFAULT "active",`balance` real DEFAULT 50,CONSTRAINT `uni_users_username` UNIQUE (`username`));
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `operations` (`id` integer PRIMARY KEY AUTOINCREMENT,`type` text NOT NULL,`cost` real NOT NULL,CONSTRAINT `uni_operations_type` UNIQUE (`type`));
+
+CREATE TABLE IF NOT EXISTS `records` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`operation_id` integer,`user_id` integer,`amount` real,`user_balance` real,`operation_result` text,`date` text,CONSTRAINT `fk_records_operation` FOREIGN KEY (`operation_id`) REFERENCES `operations`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_records_deleted_at` ON `records`(`deleted_at`);
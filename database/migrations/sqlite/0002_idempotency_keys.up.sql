@@ -0,0 +1,2 @@
+CREATE TABLE `idempotency_keys` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`user_id` integer NOT NULL,`idempotency_key` text NOT NULL,`request_hash` text NOT NULL,`record_id` integer,`status_code` integer,`response` text);
+CREATE UNIQUE INDEX `idx_idempotency_keys_user_key` ON `idempotency_keys`(`user_id`,`idempotency_key`);
@@ -0,0 +1,6 @@
+ALTER TABLE `records` ADD COLUMN `note` text;
+
+CREATE TABLE IF NOT EXISTS `tags` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer NOT NULL,`name` text NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_tags_user_name` ON `tags`(`user_id`,`name`);
+
+CREATE TABLE IF NOT EXISTS `record_tags` (`record_id` integer,`tag_id` integer,PRIMARY KEY (`record_id`,`tag_id`),CONSTRAINT `fk_record_tags_record` FOREIGN KEY (`record_id`) REFERENCES `records`(`id`),CONSTRAINT `fk_record_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`));
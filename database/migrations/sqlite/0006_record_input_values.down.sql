@@ -0,0 +1,8 @@
+-- SQLite can't drop a column used by a trigger, the full-text search index is recreated at startup when the schema
+-- supports it, see SetupFullTextSearch
+DROP TRIGGER IF EXISTS `records_fts_insert`;
+DROP TRIGGER IF EXISTS `records_fts_update`;
+DROP TRIGGER IF EXISTS `records_fts_delete`;
+DROP TABLE IF EXISTS `records_fts`;
+
+ALTER TABLE `records` DROP COLUMN `input_values`;
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"gorm.io/gorm"
+)
+
+// SetupFullTextSearch creates the records_fts index and the triggers that keep it in sync with the records table.
+// The index is backfilled with the existing records the first time it is created, and rebuilt when it was created by
+// a version that indexed the JSON of the inputs instead of their values
+func SetupFullTextSearch(db *gorm.DB) error {
+	exists := db.Migrator().HasTable("records_fts")
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{}
+		if exists && outdatedFullTextSearch(tx) {
+			exists = false
+			statements = append(statements,
+				`DROP TRIGGER IF EXISTS records_fts_insert`,
+				`DROP TRIGGER IF EXISTS records_fts_update`,
+				`DROP TRIGGER IF EXISTS records_fts_delete`,
+				`DROP TABLE records_fts`,
+			)
+		}
+
+		statements = append(statements,
+			`CREATE VIRTUAL TABLE IF NOT EXISTS records_fts USING fts5(operation_result, operation_type, input_values, note)`,
+			// Soft deletes are updates of deleted_at, so the update trigger also removes deleted records from the index
+			`CREATE TRIGGER IF NOT EXISTS records_fts_insert AFTER INSERT ON records WHEN new.deleted_at IS NULL BEGIN
+				INSERT INTO records_fts(rowid, operation_result, operation_type, input_values, note)
+				VALUES (new.id, new.operation_result, (SELECT type FROM operations WHERE id = new.operation_id), new.input_values, new.note);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS records_fts_update AFTER UPDATE ON records BEGIN
+				DELETE FROM records_fts WHERE rowid = old.id;
+				INSERT INTO records_fts(rowid, operation_result, operation_type, input_values, note)
+				SELECT new.id, new.operation_result, (SELECT type FROM operations WHERE id = new.operation_id), new.input_values, new.note
+				WHERE new.deleted_at IS NULL;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS records_fts_delete AFTER DELETE ON records BEGIN
+				DELETE FROM records_fts WHERE rowid = old.id;
+			END`,
+		)
+
+		if !exists {
+			statements = append(statements, `INSERT INTO records_fts(rowid, operation_result, operation_type, input_values, note)
+				SELECT records.id, records.operation_result, operations.type, records.input_values, records.note
+				FROM records LEFT JOIN operations ON operations.id = records.operation_id
+				WHERE records.deleted_at IS NULL`)
+		}
+
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// outdatedFullTextSearch reports whether the triggers of the index don't fill in the values of the inputs
+func outdatedFullTextSearch(db *gorm.DB) bool {
+	var definition string
+	db.Raw(`SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = 'records_fts_insert'`).Scan(&definition)
+
+	return !strings.Contains(definition, "input_values")
+}
+
+// BackfillInputValues renders the values of the inputs of the records created before they were stored, see
+// models.InputValues. It only goes through the records that don't have them yet, so it is cheap once done
+func (c *Connection) BackfillInputValues() error {
+	var records []models.Record
+	return c.DB.Select("id", "inputs").
+		Where("input_values IS NULL AND inputs IS NOT NULL").
+		FindInBatches(&records, 500, func(tx *gorm.DB, batch int) error {
+			for _, record := range records {
+				err := c.DB.Model(&models.Record{}).Where("id = ?", record.ID).
+					UpdateColumn("input_values", models.InputValues(record.Inputs)).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
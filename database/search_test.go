@@ -0,0 +1,55 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/database/testdb"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+)
+
+// TestBackfillInputValues tests that the records saved before the values of the inputs were stored can be searched by
+// them once filled in, and that a full-text search index of the JSON is rebuilt
+func TestBackfillInputValues(t *testing.T) {
+	for _, backend := range testdb.Backends() {
+		t.Run(backend, func(t *testing.T) {
+			connection := testdb.Open(t, backend)
+			store := connection.Store()
+			database.SeedOperations(store.Operations())
+
+			// The index of the previous version, whose triggers indexed the JSON
+			if connection.FullTextSearch {
+				for _, trigger := range []string{"insert", "update"} {
+					connection.DB.Exec(`DROP TRIGGER records_fts_` + trigger)
+					connection.DB.Exec(`CREATE TRIGGER records_fts_` + trigger + ` AFTER ` + trigger + ` ON records BEGIN SELECT 1; END`)
+				}
+			}
+
+			err := connection.DB.Exec(`INSERT INTO records (created_at, updated_at, operation_id, user_id, operation_result, inputs)
+				VALUES (?, ?, 1, 1, '8', '{"number1":5,"number2":3}')`, time.Now(), time.Now()).Error
+			if err != nil {
+				t.Fatalf("unexpected error inserting the record: %v", err)
+			}
+			if connection.FullTextSearch {
+				connection.DB.Exec(`INSERT INTO records_fts(rowid, operation_result, input_values) SELECT id, operation_result, inputs FROM records`)
+			}
+
+			if err := connection.BackfillInputValues(); err != nil {
+				t.Fatalf("unexpected error filling in the input values: %v", err)
+			}
+			if connection.FullTextSearch {
+				if err := database.SetupFullTextSearch(connection.DB); err != nil {
+					t.Fatalf("unexpected error rebuilding the index: %v", err)
+				}
+			}
+
+			for search, expected := range map[string]int64{"number": 0, "5": 1} {
+				page, err := store.Records().List(1, repositories.RecordFilter{Search: search}, 10, 0)
+				if err != nil || page.Total != expected {
+					t.Errorf("expected %d records matching %q, got %d, %v", expected, search, page.Total, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Package logging creates the structured logger of the server and carries the request-scoped logger,
+// which has the request ID, in the request context
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
+)
+
+// New creates the logger selected in the configuration, the level and format are validated when it is loaded
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level))
+
+	options := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+type contextKey struct{}
+
+// WithLogger returns a copy of the context carrying the logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of the context, or the default logger when there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
@@ -1,47 +1,255 @@
 package main
 
 import (
-	"github.com/go-resty/resty/v2"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
 	"github.com/ricardofabila/arithmetic-calculator-backend/controllers"
 	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/logging"
+	"github.com/ricardofabila/arithmetic-calculator-backend/metrics"
+	"github.com/ricardofabila/arithmetic-calculator-backend/middlewares"
+	"github.com/ricardofabila/arithmetic-calculator-backend/ratelimit"
 	"github.com/ricardofabila/arithmetic-calculator-backend/routes"
 	"github.com/ricardofabila/arithmetic-calculator-backend/services"
-	"log"
+	"github.com/ricardofabila/arithmetic-calculator-backend/tracing"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 func main() {
-	log.Println("Starting Arithmetic Calculator Backend...")
+	// The config file is optional, every setting has a default and can be overridden by an environment variable
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a .yaml, .yml or .toml config file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-config file] [migrate up|down [steps]|status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+
+	// Everything is logged through slog, including the services and GORM which use the default logger
+	logger := logging.New(cfg.Log, os.Stdout)
+	slog.SetDefault(logger)
+	if cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	logger.Info("starting Arithmetic Calculator Backend")
+	if cfg.Auth.JWTSecret == config.DefaultJWTSecret {
+		logger.Warn("using the default JWT secret, set JWT_SECRET or auth.jwtSecret in production")
+	}
+
+	// Set up before anything that is traced. Deferred first, so the last spans are flushed after everything else stopped
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, os.Stdout)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush the traces", "error", err)
+		}
+	}()
+	if cfg.Tracing.Exporter != "none" {
+		logger.Info("tracing enabled", "exporter", cfg.Tracing.Exporter, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
+
+	connection, err := database.Connect(cfg.Database.DSN)
+	if err != nil {
+		fatal("failed to connect to the database", err)
+	}
+	defer func() {
+		if err := connection.Close(); err != nil {
+			logger.Error("failed to close the database", "error", err)
+		}
+	}()
+	logger.Info("connected to the database", "dialect", connection.Dialect)
 
-	log.Println("Connecting to the database...")
-	database.ConnectDatabase("calculator.db")
-	log.Println("Database connection established successfully.")
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(connection, flag.Args()[1:]); err != nil {
+			fatal("migration failed", err)
+		}
+		return
+	}
+
+	// Refuse to run against a schema the code doesn't expect
+	if err := connection.CheckSchema(context.Background()); err != nil {
+		fatal(fmt.Sprintf("run \"%s migrate up\" first", os.Args[0]), err)
+	}
+	if err := connection.BackfillInputValues(); err != nil {
+		fatal("failed to fill in the input values of the records", err)
+	}
+	connection.EnableFullTextSearch()
+	store := connection.Store()
 
 	// Seed operations
-	database.SeedOperations(database.DB)
-	log.Println("Seeded operations successfully.")
+	if err := database.SeedOperations(store.Operations()); err != nil {
+		fatal("failed to seed operations", err)
+	}
+	logger.Info("seeded operations")
 
-	// Initialize the Resty client
-	restyClient := resty.New()
+	// Exported at /metrics, along with the connection pool statistics
+	appMetrics := metrics.New()
+	if sqlDB, err := connection.DB.DB(); err == nil {
+		appMetrics.RegisterDB(sqlDB)
+	}
 
-	// Create an instance of RealRandomStringService with the Resty client
-	randomStringService := &services.RealRandomStringService{
-		Client: restyClient,
+	// The same provider serves the random strings and numbers
+	providers := services.NewRandomProviders(cfg.Random, appMetrics)
+	switch cfg.Random.Provider {
+	case "local":
+		logger.Info("using crypto/rand as the random string provider")
+	case "seeded":
+		logger.Warn("using a seeded PRNG as the random string provider, don't use it in production", "seed", cfg.Random.Seed)
+	default:
+		logger.Info("using random.org as the random string provider")
+	}
+	if providers.Pool != nil {
+		providers.Pool.Start()
+		// Deferred after closing the database, so the pool stops first once the server is shut down
+		defer func() {
+			providers.Pool.Stop()
+			logger.Info("stopped the random string pool")
+		}()
+		logger.Info("started the random string pool", "lengths", cfg.Random.PoolLengths)
 	}
 
-	// Create an instance of the OperationController with the real RandomStringService
-	operationController := &controllers.OperationController{
-		RandomStringService: randomStringService,
+	// The limits are kept by each instance, a shared ratelimit.Store would make them hold across instances
+	limiter := &middlewares.RateLimiter{Store: ratelimit.NewMemoryStore(), Config: cfg.RateLimit, Metrics: appMetrics}
+
+	handlers := routes.Controllers{
+		User: &controllers.UserController{
+			Users:      store.Users(),
+			JWTSecret:  []byte(cfg.Auth.JWTSecret),
+			BcryptCost: cfg.Auth.BcryptCost,
+			Metrics:    appMetrics,
+		},
+		// The OperationController uses the configured random providers
+		Operation: &controllers.OperationController{
+			Store:               store,
+			RandomStringService: providers.Strings,
+			RandomNumberService: providers.Numbers,
+			Metrics:             appMetrics,
+			RateLimiter:         limiter,
+		},
+		Record: &controllers.RecordController{Records: store.Records()},
+		Stats:  &controllers.StatsController{Users: store.Users(), Records: store.Records()},
+		Health: &controllers.HealthController{
+			RandomStringService: providers.Strings,
+			Database:            connection,
+			Operations:          store.Operations(),
+			RequiredOperations:  database.DefaultOperationTypes(),
+		},
 	}
 
 	// Set up the router
-	log.Println("Setting up router...")
-	r := routes.SetupRouter(operationController)
-	log.Println("Router setup completed.")
+	r, err := routes.SetupRouter(cfg, handlers, appMetrics, logger, limiter)
+	if err != nil {
+		fatal("failed to set up the router", err)
+	}
+
+	server := &http.Server{
+		Addr:         cfg.Server.Address(),
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+	}
+
+	// SIGINT is Ctrl+C, SIGTERM is what orchestrators send before killing the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Start the server and listen on port
-	log.Println("Starting server on port 8080...")
-	err := r.Run(":8080")
-	if err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("starting the server", "port", cfg.Server.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("failed to start the server", err)
+	case <-ctx.Done():
 	}
+	// A second signal kills the process right away
+	stop()
+
+	// Stop accepting connections and let the in-flight requests finish, so no operation is cut off between
+	// charging the user and saving the record
+	logger.Info("shutting down, waiting for the in-flight requests", "timeout", time.Duration(cfg.Server.ShutdownTimeout).String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("requests still running after the shutdown timeout were cut off", "error", err)
+	}
+	logger.Info("server stopped")
+	// The deferred calls stop the random string pool, close the database and flush the traces
+}
+
+// migrate runs the migrate subcommand: up applies the pending migrations, down reverts the last one or the given
+// number of them, and status lists them
+func migrate(connection *database.Connection, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := connection.Migrate()
+		for _, migration := range applied {
+			slog.Info("applied migration", "migration", fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+		if err == nil && len(applied) == 0 {
+			slog.Info("the schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := connection.Rollback(steps)
+		for _, migration := range reverted {
+			slog.Info("reverted migration", "migration", fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+		return err
+	case "status":
+		statuses, err := connection.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied at " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+}
+
+// fatal logs the error that keeps the server from running and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,173 @@
+// Package metrics exports the Prometheus metrics of the server at /metrics.
+// Every method can be called on a nil *Metrics, so the controllers and services work without metrics in the tests
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "calculator"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpDuration        *prometheus.HistogramVec
+	operations          *prometheus.CounterVec
+	creditsSpent        *prometheus.CounterVec
+	insufficientBalance *prometheus.CounterVec
+	randomOrgDuration   *prometheus.HistogramVec
+	randomOrgErrors     *prometheus.CounterVec
+	logins              *prometheus.CounterVec
+	rateLimited         *prometheus.CounterVec
+}
+
+// New creates the metrics in their own registry, along with the Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the HTTP requests by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operations_total",
+			Help:      "Operations performed by type.",
+		}, []string{"operation"}),
+		creditsSpent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "credits_spent_total",
+			Help:      "Credits charged to the users by operation type.",
+		}, []string{"operation"}),
+		insufficientBalance: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "insufficient_balance_total",
+			Help:      "Operations rejected because the user's balance didn't cover the cost, by operation type.",
+		}, []string{"operation"}),
+		randomOrgDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "random_org_request_duration_seconds",
+			Help:      "Latency of the calls to random.org by endpoint, retries included.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"endpoint"}),
+		randomOrgErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "random_org_errors_total",
+			Help:      "Failed calls to random.org by endpoint.",
+		}, []string{"endpoint"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by result, success or failure.",
+		}, []string{"result"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests refused with a 429 because the client went over the rate limit, by route and method.",
+		}, []string{"method", "route"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration,
+		m.operations, m.creditsSpent, m.insufficientBalance,
+		m.randomOrgDuration, m.randomOrgErrors,
+		m.logins, m.rateLimited,
+	)
+
+	return m
+}
+
+// RegisterDB exports the connection pool statistics of the database, e.g. the open and in use connections
+func (m *Metrics) RegisterDB(db *sql.DB) {
+	if m == nil {
+		return
+	}
+
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request. The route is the pattern, e.g. /api/v1/records/:id,
+// so the IDs in the paths don't create a series per record
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveOperation records an operation performed and the credits it cost
+func (m *Metrics) ObserveOperation(operation string, cost float64) {
+	if m == nil {
+		return
+	}
+
+	m.operations.WithLabelValues(operation).Inc()
+	m.creditsSpent.WithLabelValues(operation).Add(cost)
+}
+
+// ObserveInsufficientBalance records an operation refused because the user couldn't pay for it
+func (m *Metrics) ObserveInsufficientBalance(operation string) {
+	if m == nil {
+		return
+	}
+
+	m.insufficientBalance.WithLabelValues(operation).Inc()
+}
+
+// ObserveLogin records a login attempt
+func (m *Metrics) ObserveLogin(success bool) {
+	if m == nil {
+		return
+	}
+
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	m.logins.WithLabelValues(result).Inc()
+}
+
+// ObserveRandomOrgCall records a call to random.org, it implements services.RandomOrgObserver
+func (m *Metrics) ObserveRandomOrgCall(endpoint string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.randomOrgDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if err != nil {
+		m.randomOrgErrors.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// ObserveRateLimited records a request refused by the rate limiter
+func (m *Metrics) ObserveRateLimited(method, route string) {
+	if m == nil {
+		return
+	}
+
+	m.rateLimited.WithLabelValues(method, route).Inc()
+}
@@ -0,0 +1,60 @@
+package metrics_test
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/metrics"
+)
+
+// scrape returns the metrics served by the handler
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	m.ObserveRequest("POST", "/api/v1/operation", 200, 20*time.Millisecond)
+	m.ObserveOperation("addition", 1)
+	m.ObserveOperation("addition", 1)
+	m.ObserveInsufficientBalance("random_string")
+	m.ObserveLogin(true)
+	m.ObserveLogin(false)
+	m.ObserveRandomOrgCall("strings", 300*time.Millisecond, errors.New("timeout"))
+
+	body := scrape(t, m)
+	for _, expected := range []string{
+		`calculator_http_requests_total{method="POST",route="/api/v1/operation",status="200"} 1`,
+		`calculator_http_request_duration_seconds_count{method="POST",route="/api/v1/operation"} 1`,
+		`calculator_operations_total{operation="addition"} 2`,
+		`calculator_credits_spent_total{operation="addition"} 2`,
+		`calculator_insufficient_balance_total{operation="random_string"} 1`,
+		`calculator_logins_total{result="failure"} 1`,
+		`calculator_logins_total{result="success"} 1`,
+		`calculator_random_org_request_duration_seconds_count{endpoint="strings"} 1`,
+		`calculator_random_org_errors_total{endpoint="strings"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the metrics to contain %s", expected)
+		}
+	}
+}
+
+// TestMetrics_Nil tests that the metrics can be left out
+func TestMetrics_Nil(t *testing.T) {
+	var m *metrics.Metrics
+	m.ObserveRequest("GET", "/health", 200, time.Millisecond)
+	m.ObserveOperation("addition", 1)
+	m.ObserveInsufficientBalance("addition")
+	m.ObserveLogin(true)
+	m.ObserveRandomOrgCall("quota", time.Millisecond, nil)
+	m.RegisterDB(nil)
+}
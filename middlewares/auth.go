@@ -8,7 +8,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+// JWTAuthMiddleware accepts the tokens signed with the secret and sets the user_id of their claims
+func JWTAuthMiddleware(secret []byte) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -19,7 +20,7 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 
 		tokenString := strings.Split(authHeader, " ")[1]
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte("secret"), nil
+			return secret, nil
 		})
 
 		if err != nil {
@@ -0,0 +1,86 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
+	"github.com/ricardofabila/arithmetic-calculator-backend/logging"
+	"github.com/ricardofabila/arithmetic-calculator-backend/middlewares"
+)
+
+// serve sends a request through the logging middlewares and returns the response and the decoded log line
+func serve(t *testing.T, router *gin.Engine, logs *bytes.Buffer, req *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+	logs.Reset()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var line map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(logs.Bytes()), &line); err != nil {
+		t.Fatalf("expected a single JSON log line, got %q: %v", logs.String(), err)
+	}
+	return w, line
+}
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := logging.New(config.LogConfig{Level: "info", Format: "json"}, &logs)
+
+	router := gin.New()
+	router.Use(middlewares.RequestLoggerMiddleware(logger), middlewares.RecoveryMiddleware())
+	router.POST("/operation", func(c *gin.Context) {
+		c.Set("user_id", uint(7))
+		c.Set("operation", "addition")
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		c.Error(errors.New("database is locked"))
+		c.JSON(http.StatusInternalServerError, gin.H{})
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	req, _ := http.NewRequest("POST", "/operation", nil)
+	w, line := serve(t, router, &logs, req)
+	requestID := w.Header().Get(middlewares.RequestIDHeader)
+	if len(requestID) != 32 {
+		t.Fatalf("expected a generated request ID, got %q", requestID)
+	}
+	if line["request_id"] != requestID || line["level"] != "INFO" || line["route"] != "/operation" {
+		t.Errorf("expected the request to be logged with its ID, got %v", line)
+	}
+	if line["user_id"] != float64(7) || line["operation"] != "addition" || line["status"] != float64(http.StatusOK) {
+		t.Errorf("expected the user and operation to be logged, got %v", line)
+	}
+
+	// The ID sent by a proxy is kept, unless it isn't safe to log
+	req, _ = http.NewRequest("GET", "/fail", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "edge-42")
+	w, line = serve(t, router, &logs, req)
+	if w.Header().Get(middlewares.RequestIDHeader) != "edge-42" || line["request_id"] != "edge-42" {
+		t.Errorf("expected the request ID to be propagated, got %q and %v", w.Header().Get(middlewares.RequestIDHeader), line)
+	}
+	if line["level"] != "ERROR" || line["errors"] == nil {
+		t.Errorf("expected the failure to be logged as an error, got %v", line)
+	}
+
+	req, _ = http.NewRequest("GET", "/fail", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "bad id\nwith a newline")
+	if w, _ = serve(t, router, &logs, req); w.Header().Get(middlewares.RequestIDHeader) == "bad id\nwith a newline" {
+		t.Error("expected an invalid request ID to be replaced")
+	}
+
+	req, _ = http.NewRequest("GET", "/panic", nil)
+	w = httptest.NewRecorder()
+	logs.Reset()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError || !bytes.Contains(logs.Bytes(), []byte(`"panic":"boom"`)) {
+		t.Errorf("expected the panic to be logged and answered with a 500, got %v %s", w.Code, logs.String())
+	}
+}
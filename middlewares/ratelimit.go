@@ -0,0 +1,108 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
+	"github.com/ricardofabila/arithmetic-calculator-backend/logging"
+	"github.com/ricardofabila/arithmetic-calculator-backend/metrics"
+	"github.com/ricardofabila/arithmetic-calculator-backend/ratelimit"
+)
+
+// RateLimiter applies the configured limits, every route has its own bucket for each client
+type RateLimiter struct {
+	Store   ratelimit.Store
+	Config  config.RateLimitConfig
+	Metrics *metrics.Metrics // optional
+}
+
+// ByIP limits the public routes by client IP
+func (l *RateLimiter) ByIP() gin.HandlerFunc {
+	return l.middleware(false, clientIP)
+}
+
+// ByUser limits the protected routes by user, it must run after JWTAuthMiddleware
+func (l *RateLimiter) ByUser() gin.HandlerFunc {
+	return l.middleware(true, user)
+}
+
+func clientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+func user(c *gin.Context) string {
+	if userID, exists := c.Get("user_id"); exists {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return clientIP(c)
+}
+
+// middleware takes a token from the bucket of the client for the route, and responds with a 429 when there is none.
+// The RateLimit headers tell the clients how many requests they have left
+func (l *RateLimiter) middleware(protected bool, client func(c *gin.Context) string) gin.HandlerFunc {
+	if !l.Config.Enabled {
+		return func(c *gin.Context) {}
+	}
+
+	return func(c *gin.Context) {
+		l.take(c, c.Request.Method, c.FullPath(), protected, client, 1, true)
+	}
+}
+
+// Take takes tokens from the user's bucket of another protected route, for requests that count as several requests
+// to it, e.g. the random operations of a batch count against the limit of POST /api/v1/operation. It responds with
+// a 429 when they are refused and reports whether the request can go on. The RateLimit headers keep describing the
+// route of the request unless the tokens are refused
+func (l *RateLimiter) Take(c *gin.Context, method, route string, tokens int) bool {
+	if !l.Config.Enabled {
+		return true
+	}
+
+	return l.take(c, method, route, true, user, tokens, false)
+}
+
+// take takes the tokens from the bucket of the client for the route, and aborts the request with a 429 when they are
+// refused. The RateLimit headers are set when the tokens are refused, and always with headers
+func (l *RateLimiter) take(c *gin.Context, method, route string, protected bool, client func(c *gin.Context) string, tokens int, headers bool) bool {
+	limit := l.Config.Limit(method, route, protected)
+	key := method + " " + route + " " + client(c)
+
+	result, err := l.Store.Take(c.Request.Context(), key, ratelimit.Limit{
+		Requests: limit.Requests,
+		Period:   time.Duration(limit.Period),
+		Burst:    limit.Burst,
+	}, tokens)
+	if err != nil {
+		// The service keeps working when a shared store can't be reached
+		logging.FromContext(c.Request.Context()).Warn("rate limit store failed, letting the request through", "error", err)
+		return true
+	}
+
+	if headers || !result.Allowed {
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", seconds(result.Reset))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Requests, seconds(time.Duration(limit.Period))))
+	}
+
+	if !result.Allowed {
+		l.Metrics.ObserveRateLimited(c.Request.Method, c.FullPath())
+		c.Header("Retry-After", seconds(result.RetryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": fmt.Sprintf("Too many requests, try again in %s seconds", seconds(result.RetryAfter)),
+		})
+		return false
+	}
+
+	return true
+}
+
+// seconds formats a duration in whole seconds, rounded up so clients don't retry too early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,137 @@
+package middlewares_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
+	"github.com/ricardofabila/arithmetic-calculator-backend/middlewares"
+	"github.com/ricardofabila/arithmetic-calculator-backend/ratelimit"
+)
+
+// failingStore can't be reached
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit, tokens int) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func newRateLimitedRouter(store ratelimit.Store, enabled bool) *gin.Engine {
+	limiter := &middlewares.RateLimiter{Store: store, Config: config.RateLimitConfig{
+		Enabled:   enabled,
+		Public:    config.RateLimit{Requests: 10, Period: config.Duration(time.Minute)},
+		Protected: config.RateLimit{Requests: 10, Period: config.Duration(time.Minute)},
+		Routes: map[string]config.RateLimit{
+			"POST /login":     {Requests: 2, Period: config.Duration(time.Minute)},
+			"POST /operation": {Requests: 1, Period: config.Duration(time.Minute)},
+		},
+	}}
+
+	router := gin.New()
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) }
+	router.POST("/login", limiter.ByIP(), ok)
+	authenticate := func(c *gin.Context) {
+		userID, _ := strconv.ParseFloat(c.GetHeader("X-User"), 64)
+		c.Set("user_id", userID) // Mock user authentication, the IDs of the JWT claims are float64
+	}
+	router.POST("/operation", authenticate, limiter.ByUser(), ok)
+	// Every batch counts as two operations
+	router.POST("/batch", authenticate, limiter.ByUser(), func(c *gin.Context) {
+		if limiter.Take(c, "POST", "/operation", 2) {
+			ok(c)
+		}
+	})
+	return router
+}
+
+func post(router *gin.Engine, path, ip, user string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, nil)
+	req.RemoteAddr = ip + ":1234"
+	req.Header.Set("X-User", user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimiter(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore(), true)
+
+	for i := 0; i < 2; i++ {
+		if w := post(router, "/login", "10.0.0.1", ""); w.Code != http.StatusOK {
+			t.Fatalf("expected login %d to be allowed, got %v", i+1, w.Code)
+		}
+	}
+
+	w := post(router, "/login", "10.0.0.1", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status Too Many Requests, got %v", w.Code)
+	}
+	for header, expected := range map[string]string{
+		"Retry-After":         "30",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    "2;w=60",
+	} {
+		if w.Header().Get(header) != expected {
+			t.Errorf("expected %s to be %s, got %q", header, expected, w.Header().Get(header))
+		}
+	}
+
+	if w := post(router, "/login", "10.0.0.2", ""); w.Code != http.StatusOK {
+		t.Errorf("expected another IP to have its own limit, got %v", w.Code)
+	}
+
+	// Protected routes are limited by user, whatever their IP
+	if w := post(router, "/operation", "10.0.0.1", "1"); w.Code != http.StatusOK {
+		t.Errorf("expected the first operation to be allowed, got %v", w.Code)
+	}
+	if w := post(router, "/operation", "10.0.0.3", "1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the user to be limited from another IP, got %v", w.Code)
+	}
+	if w := post(router, "/operation", "10.0.0.1", "2"); w.Code != http.StatusOK {
+		t.Errorf("expected another user to have its own limit, got %v", w.Code)
+	}
+}
+
+func TestRateLimiter_Passthrough(t *testing.T) {
+	disabled := newRateLimitedRouter(ratelimit.NewMemoryStore(), false)
+	unreachable := newRateLimitedRouter(failingStore{}, true)
+
+	for i := 0; i < 5; i++ {
+		if w := post(disabled, "/login", "10.0.0.1", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("expected no limit when rate limiting is disabled, got %v", w.Code)
+		}
+		if w := post(unreachable, "/login", "10.0.0.1", ""); w.Code != http.StatusOK {
+			t.Fatalf("expected the requests to go through while the store can't be reached, got %v", w.Code)
+		}
+	}
+}
+
+func TestRateLimiter_Take(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore(), true)
+
+	// The batch takes the only token of the operations, more than the bucket holds need it to be full
+	w := post(router, "/batch", "10.0.0.1", "1")
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "10" {
+		t.Fatalf("expected the batch to be allowed with the headers of its route, got %v %v", w.Code, w.Header())
+	}
+	if w := post(router, "/operation", "10.0.0.1", "1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the operations of the batch to be counted, got %v", w.Code)
+	}
+	w = post(router, "/batch", "10.0.0.1", "1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("Retry-After") != "120" {
+		t.Errorf("expected the next batch to wait for the debt of the operations, got %v %v", w.Code, w.Header())
+	}
+
+	// Other users have their own buckets
+	if w := post(router, "/operation", "10.0.0.1", "2"); w.Code != http.StatusOK {
+		t.Errorf("expected another user to be allowed, got %v", w.Code)
+	}
+}
@@ -1,18 +1,32 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Strings that are indexed or have a default are sized, MySQL can't do either on TEXT columns
 type User struct {
 	gorm.Model
-	Username string  `gorm:"unique;not null" json:"username"`
+	Username string  `gorm:"size:255;unique;not null" json:"username"`
 	Password string  `gorm:"not null" json:"password"`
-	Status   string  `gorm:"default:active" json:"status"`
+	Status   string  `gorm:"size:32;default:active" json:"status"`
 	Balance  float64 `gorm:"default:50" json:"balance"`
+	Role     string  `gorm:"size:32;default:user" json:"role"` // admins are promoted directly in the database
 }
 
 type Operation struct {
 	ID   uint    `gorm:"primaryKey" json:"id"`
-	Type string  `gorm:"unique;not null" json:"type"`
+	Type string  `gorm:"size:64;unique;not null" json:"type"`
 	Cost float64 `gorm:"not null" json:"cost"`
 }
 
@@ -23,6 +37,75 @@ type Record struct {
 	Amount          float64   `json:"amount"`
 	UserBalance     float64   `json:"userBalance"`
 	OperationResult string    `json:"operationResult"` // string since it can be a number or a string
+	Inputs          string    `json:"inputs"`          // JSON encoded inputs of the operation
+	InputValues     string    `json:"-"`               // the values of the inputs without their names, searched instead of the JSON
 	Date            string    `json:"date"`
+	Note            string    `json:"note"`
 	Operation       Operation `json:"operation" gorm:"foreignKey:OperationID"`
+	Tags            []Tag     `json:"tags" gorm:"many2many:record_tags"`
+}
+
+// BeforeSave renders the values of the inputs for the search whenever the record is saved
+func (r *Record) BeforeSave(tx *gorm.DB) error {
+	r.InputValues = InputValues(r.Inputs)
+	return nil
+}
+
+// InputValues renders the values of JSON encoded inputs separated by spaces, e.g. "5 3" for
+// {"number1": 5, "number2": 3}. The names and the flags are left out since they match every record of an operation
+func InputValues(inputs string) string {
+	decoder := json.NewDecoder(strings.NewReader(inputs))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return ""
+	}
+
+	var values []string
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch value := value.(type) {
+		case string:
+			values = append(values, value)
+		case json.Number:
+			values = append(values, value.String())
+		case []interface{}:
+			for _, item := range value {
+				collect(item)
+			}
+		case map[string]interface{}:
+			// Maps have no order, the names are sorted so number1 comes before number2
+			names := make([]string, 0, len(value))
+			for name := range value {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				collect(value[name])
+			}
+		}
+	}
+	collect(decoded)
+
+	return strings.Join(values, " ")
+}
+
+// Tag is a user-defined label used to group records, names are unique per user
+type Tag struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"uniqueIndex:idx_tags_user_name;not null" json:"userId"`
+	Name   string `gorm:"size:255;uniqueIndex:idx_tags_user_name;not null" json:"name"`
+}
+
+// IdempotencyKey keeps the response to an operation performed with an Idempotency-Key header, so a retry with the same
+// key gets it again instead of being charged twice. Keys are unique per user
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UserID      uint      `gorm:"uniqueIndex:idx_idempotency_keys_user_key;not null" json:"userId"`
+	Key         string    `gorm:"column:idempotency_key;size:255;uniqueIndex:idx_idempotency_keys_user_key;not null" json:"key"`
+	RequestHash string    `gorm:"size:64;not null" json:"requestHash"` // SHA-256 of the request, hex encoded
+	RecordID    uint      `json:"recordId"`                            // the record created by the operation
+	StatusCode  int       `json:"statusCode"`
+	Response    string    `json:"response"` // JSON encoded response body
 }
@@ -0,0 +1,138 @@
+// Package ratelimit limits how often a client can call a route with token buckets. Every bucket holds up to Burst
+// tokens and is refilled at Requests per Period, a request takes one token and is refused when the bucket is empty.
+// A request can also count as several, e.g. a batch of operations. One taking more tokens than the bucket holds needs
+// a full bucket and leaves it in debt, so the next requests wait until the debt is paid and the rate still holds
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is the rate allowed for a key
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int // the size of the bucket, Requests when zero
+}
+
+// capacity is the number of tokens of a full bucket
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+
+	return float64(l.Requests)
+}
+
+// perSecond is the rate at which the tokens are refilled
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the state of a bucket after a request
+type Result struct {
+	Allowed    bool
+	Limit      int           // the size of the bucket
+	Remaining  int           // whole tokens left
+	RetryAfter time.Duration // until the next token is available, only set when the request was refused
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Store keeps the buckets. MemoryStore works for a single instance, a store shared by every instance, e.g. on Redis,
+// makes the limits hold for the whole deployment
+type Store interface {
+	// Take takes the tokens from the bucket of the key, creating a full one when it doesn't exist
+	Take(ctx context.Context, key string, limit Limit, tokens int) (Result, error)
+}
+
+// bucket is a token bucket as of the last time it was used
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// take refills the bucket up to now and takes the tokens when there are enough, a full bucket is enough for any number
+func (b *bucket) take(now time.Time, limit Limit, tokens int) Result {
+	capacity, rate := limit.capacity(), limit.perSecond()
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	b.limit = limit
+
+	needed := math.Min(float64(tokens), capacity)
+	result := Result{Limit: int(capacity)}
+	if b.tokens >= needed {
+		b.tokens -= float64(tokens)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((needed - b.tokens) / rate)
+	}
+	result.Remaining = int(math.Max(0, b.tokens))
+	result.Reset = seconds((capacity - b.tokens) / rate)
+
+	return result
+}
+
+// full reports whether the bucket has been refilled by now, so forgetting it changes nothing
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*b.limit.perSecond() >= b.limit.capacity()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// sweepInterval is how often MemoryStore forgets the buckets that are full again
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the buckets in memory, the limits apply to each instance separately
+type MemoryStore struct {
+	Now func() time.Time // time.Now when nil, set by the tests
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, tokens int) (Result, error) {
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Clients that stopped calling would otherwise keep their buckets forever
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, b := range s.buckets {
+			if b.full(now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.capacity(), updated: now}
+		s.buckets[key] = b
+	}
+
+	return b.take(now, limit, tokens), nil
+}
+
+// Len returns the number of buckets kept
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.buckets)
+}
@@ -0,0 +1,78 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/ratelimit"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := ratelimit.NewMemoryStore()
+	store.Now = func() time.Time { return now }
+	limit := ratelimit.Limit{Requests: 60, Period: time.Minute, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if result, _ := store.Take(context.Background(), "client", limit, 1); !result.Allowed || result.Remaining != 1-i {
+			t.Fatalf("expected request %d of the burst to be allowed, got %+v", i+1, result)
+		}
+	}
+
+	result, _ := store.Take(context.Background(), "client", limit, 1)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 2*time.Second || result.Limit != 2 {
+		t.Errorf("expected the request to be refused for a second, got %+v", result)
+	}
+	if result, _ := store.Take(context.Background(), "other", limit, 1); !result.Allowed {
+		t.Errorf("expected every key to have its own bucket, got %+v", result)
+	}
+
+	// A token is added every second
+	now = now.Add(time.Second)
+	if result, _ := store.Take(context.Background(), "client", limit, 1); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected the refilled token to be taken, got %+v", result)
+	}
+
+	// The buckets that are full again are forgotten
+	now = now.Add(time.Hour)
+	store.Take(context.Background(), "new", limit, 1)
+	if store.Len() != 1 {
+		t.Errorf("expected the idle buckets to be removed, got %d buckets", store.Len())
+	}
+}
+
+func TestMemoryStore_DefaultBurst(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Requests: 3, Period: time.Hour}
+
+	for i := 0; i < 3; i++ {
+		store.Take(context.Background(), "client", limit, 1)
+	}
+	if result, _ := store.Take(context.Background(), "client", limit, 1); result.Allowed || result.Limit != 3 {
+		t.Errorf("expected the bucket to hold the requests of a period, got %+v", result)
+	}
+}
+
+func TestMemoryStore_TakeSeveral(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := ratelimit.NewMemoryStore()
+	store.Now = func() time.Time { return now }
+	limit := ratelimit.Limit{Requests: 60, Period: time.Minute, Burst: 10}
+
+	if result, _ := store.Take(context.Background(), "client", limit, 4); !result.Allowed || result.Remaining != 6 {
+		t.Fatalf("expected the 4 tokens to be taken, got %+v", result)
+	}
+	if result, _ := store.Take(context.Background(), "client", limit, 8); result.Allowed || result.RetryAfter != 2*time.Second {
+		t.Errorf("expected 8 tokens to be refused until 2 more are added, got %+v", result)
+	}
+
+	// More tokens than the bucket holds need a full bucket, and the debt is paid before the next request
+	now = now.Add(4 * time.Second)
+	if result, _ := store.Take(context.Background(), "client", limit, 30); !result.Allowed || result.Remaining != 0 || result.Reset != 30*time.Second {
+		t.Errorf("expected the full bucket to be enough, got %+v", result)
+	}
+	if result, _ := store.Take(context.Background(), "client", limit, 1); result.Allowed || result.RetryAfter != 21*time.Second {
+		t.Errorf("expected the next request to wait for the debt, got %+v", result)
+	}
+}
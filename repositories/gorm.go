@@ -0,0 +1,343 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+	"gorm.io/gorm"
+)
+
+// GormStore keeps everything in the database opened by the database package
+type GormStore struct {
+	db             *gorm.DB
+	fullTextSearch bool // the records_fts index is available
+}
+
+func NewGormStore(db *gorm.DB, fullTextSearch bool) *GormStore {
+	return &GormStore{db: db, fullTextSearch: fullTextSearch}
+}
+
+func (s *GormStore) Users() UserRepository {
+	return &gormUsers{db: s.db}
+}
+
+func (s *GormStore) Operations() OperationRepository {
+	return &gormOperations{db: s.db}
+}
+
+func (s *GormStore) Records() RecordRepository {
+	return &gormRecords{db: s.db, fullTextSearch: s.fullTextSearch}
+}
+
+func (s *GormStore) IdempotencyKeys() IdempotencyKeyRepository {
+	return &gormIdempotencyKeys{db: s.db}
+}
+
+func (s *GormStore) Transaction(fn func(store Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{db: tx, fullTextSearch: s.fullTextSearch})
+	})
+}
+
+func (s *GormStore) WithContext(ctx context.Context) Store {
+	return &GormStore{db: s.db.WithContext(ctx), fullTextSearch: s.fullTextSearch}
+}
+
+// notFound translates GORM's missing row error to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r *gormUsers) WithContext(ctx context.Context) UserRepository {
+	return &gormUsers{db: r.db.WithContext(ctx)}
+}
+
+func (r *gormUsers) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUsers) FindByID(id uint) (models.User, error) {
+	var user models.User
+	err := r.db.First(&user, id).Error
+	return user, notFound(err)
+}
+
+func (r *gormUsers) FindByUsername(username string) (models.User, error) {
+	var user models.User
+	err := r.db.Where("username = ?", username).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r *gormUsers) Save(user *models.User) error {
+	return r.db.Save(user).Error
+}
+
+func (r *gormUsers) Charge(userID uint, amount float64) (float64, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND balance >= ?", userID, amount).
+		Update("balance", gorm.Expr("balance - ?", amount))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	// The updated row is locked until the transaction ends, so the balance read back is the one just written
+	user, err := r.FindByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	// MySQL only counts the rows that changed, the balance is checked again in case nothing did
+	if result.RowsAffected == 0 && user.Balance < amount {
+		return user.Balance, ErrInsufficientBalance
+	}
+
+	return user.Balance, nil
+}
+
+type gormIdempotencyKeys struct {
+	db *gorm.DB
+}
+
+func (r *gormIdempotencyKeys) WithContext(ctx context.Context) IdempotencyKeyRepository {
+	return &gormIdempotencyKeys{db: r.db.WithContext(ctx)}
+}
+
+func (r *gormIdempotencyKeys) Find(userID uint, key string) (models.IdempotencyKey, error) {
+	var idempotencyKey models.IdempotencyKey
+	err := r.db.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&idempotencyKey).Error
+	return idempotencyKey, notFound(err)
+}
+
+func (r *gormIdempotencyKeys) Create(key *models.IdempotencyKey) error {
+	return r.db.Create(key).Error
+}
+
+type gormOperations struct {
+	db *gorm.DB
+}
+
+func (r *gormOperations) WithContext(ctx context.Context) OperationRepository {
+	return &gormOperations{db: r.db.WithContext(ctx)}
+}
+
+func (r *gormOperations) FindByType(operationType string) (models.Operation, error) {
+	var operation models.Operation
+	err := r.db.Where("type = ?", operationType).First(&operation).Error
+	return operation, notFound(err)
+}
+
+func (r *gormOperations) FindOrCreate(operation *models.Operation) error {
+	return r.db.Where("type = ?", operation.Type).FirstOrCreate(operation).Error
+}
+
+// likeEscaper escapes the LIKE wildcards with the ! escape character, which needs no quoting in any SQL dialect
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+type gormRecords struct {
+	db             *gorm.DB
+	fullTextSearch bool
+}
+
+// applyFilter adds the filter conditions to the given query.
+// Columns are qualified since searching joins the records_fts index
+func (r *gormRecords) applyFilter(query *gorm.DB, filter RecordFilter) *gorm.DB {
+	if filter.Searching() {
+		if r.fullTextSearch {
+			query = query.Joins("JOIN records_fts ON records_fts.rowid = records.id").
+				Where("records_fts MATCH ?", MatchExpression(filter.Search))
+		} else {
+			// LIKE is case-sensitive on PostgreSQL, and the wildcards typed by the user are matched literally
+			like := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+			query = query.Where(
+				"LOWER(records.operation_result) LIKE ? ESCAPE '!' OR LOWER(records.input_values) LIKE ? ESCAPE '!' OR LOWER(records.note) LIKE ? ESCAPE '!'",
+				like, like, like,
+			)
+		}
+	}
+
+	if filter.Tag != "" {
+		tagged := query.Session(&gorm.Session{NewDB: true}).
+			Table("record_tags").
+			Select("record_tags.record_id").
+			Joins("JOIN tags ON tags.id = record_tags.tag_id").
+			Where("tags.name = ?", strings.TrimSpace(filter.Tag))
+		query = query.Where("records.id IN (?)", tagged)
+	}
+
+	return query
+}
+
+func (r *gormRecords) WithContext(ctx context.Context) RecordRepository {
+	return &gormRecords{db: r.db.WithContext(ctx), fullTextSearch: r.fullTextSearch}
+}
+
+func (r *gormRecords) Create(record *models.Record) error {
+	return r.db.Create(record).Error
+}
+
+func (r *gormRecords) FindForUser(userID, recordID uint) (models.Record, error) {
+	var record models.Record
+	err := r.db.Preload("Operation").Preload("Tags").
+		Where("id = ? AND user_id = ?", recordID, userID).
+		First(&record).Error
+	return record, notFound(err)
+}
+
+func (r *gormRecords) List(userID uint, filter RecordFilter, limit, offset int) (RecordPage, error) {
+	query := r.applyFilter(r.db.Where("records.user_id = ?", userID), filter)
+
+	var page RecordPage
+	if err := query.Model(&models.Record{}).Count(&page.Total).Error; err != nil {
+		return RecordPage{}, err
+	}
+
+	// Full-text matches are sorted by relevance
+	// otherwise in the order they were created, which not every database does on its own
+	ranked := filter.Searching() && r.fullTextSearch
+	if ranked {
+		query = query.Order("records_fts.rank")
+	} else {
+		query = query.Order("records.id")
+	}
+
+	// using offset pagination and not a cursor to keep things simple
+	if err := query.Preload("Operation").Preload("Tags").Limit(limit).Offset(offset).Find(&page.Records).Error; err != nil {
+		return RecordPage{}, err
+	}
+
+	if ranked {
+		page.Snippets = map[uint]string{}
+		if len(page.Records) > 0 {
+			recordIDs := make([]uint, len(page.Records))
+			for i, record := range page.Records {
+				recordIDs[i] = record.ID
+			}
+
+			snippets, err := SearchSnippets(r.db, filter.Search, recordIDs)
+			if err != nil {
+				return RecordPage{}, err
+			}
+			page.Snippets = snippets
+		}
+	}
+
+	return page, nil
+}
+
+func (r *gormRecords) Annotate(record *models.Record, note *string, tags []string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if note != nil {
+			if err := tx.Model(record).Update("note", *note).Error; err != nil {
+				return err
+			}
+		}
+
+		if tags != nil {
+			userTags, err := (&gormRecords{db: tx}).FindOrCreateTags(record.UserID, tags)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(record).Association("Tags").Replace(userTags); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.db.Preload("Operation").Preload("Tags").First(record, record.ID).Error
+}
+
+func (r *gormRecords) Delete(userID, recordID uint) error {
+	var record models.Record
+	if err := r.db.Where("id = ? AND user_id = ?", recordID, userID).First(&record).Error; err != nil {
+		return notFound(err)
+	}
+
+	return r.db.Delete(&record).Error
+}
+
+func (r *gormRecords) DeleteMatching(userID uint, ids []uint, filter RecordFilter) ([]uint, error) {
+	deleted := []uint{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("records.user_id = ?", userID)
+		if len(ids) > 0 {
+			query = query.Where("records.id IN ?", ids)
+		}
+		query = r.applyFilter(query, filter)
+
+		var records []models.Record
+		if err := query.Find(&records).Error; err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		if err := tx.Delete(&records).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			deleted = append(deleted, record.ID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+func (r *gormRecords) FindOrCreateTags(userID uint, names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	for _, name := range tagNames(names) {
+		tag := models.Tag{UserID: userID, Name: name}
+		if err := r.db.Where("user_id = ? AND name = ?", userID, name).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (r *gormRecords) StatsEntries(statsQuery StatsQuery) ([]services.StatsEntry, error) {
+	// Deleted records are included since they were still paid for
+	query := r.db.Unscoped().
+		Table("records").
+		Select("records.user_id, operations.type AS operation, records.amount, records.user_balance, records.created_at").
+		Joins("JOIN operations ON operations.id = records.operation_id")
+
+	if statsQuery.UserID != 0 {
+		query = query.Where("records.user_id = ?", statsQuery.UserID)
+	}
+	if !statsQuery.From.IsZero() {
+		query = query.Where("records.created_at >= ?", statsQuery.From)
+	}
+	if !statsQuery.To.IsZero() {
+		query = query.Where("records.created_at < ?", statsQuery.To)
+	}
+
+	var entries []services.StatsEntry
+	if err := query.Order("records.created_at, records.id").Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
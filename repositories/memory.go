@@ -0,0 +1,515 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+	"gorm.io/gorm"
+)
+
+// MemoryStore keeps everything in memory. It is meant for unit tests, every test can use its own store
+// so they can run in parallel. Search falls back to a case-insensitive substring match like the LIKE search
+type MemoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+
+	txMu sync.Mutex // transactions run one at a time
+}
+
+type memoryData struct {
+	users      []models.User
+	operations []models.Operation
+	records    []models.Record
+	tags       []models.Tag
+	recordTags map[uint][]uint // record ID to tag IDs
+
+	idempotencyKeys []models.IdempotencyKey
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: &memoryData{recordTags: map[uint][]uint{}}}
+}
+
+func (s *MemoryStore) Users() UserRepository {
+	return &memoryUsers{store: s}
+}
+
+func (s *MemoryStore) Operations() OperationRepository {
+	return &memoryOperations{store: s}
+}
+
+func (s *MemoryStore) Records() RecordRepository {
+	return &memoryRecords{store: s}
+}
+
+func (s *MemoryStore) IdempotencyKeys() IdempotencyKeyRepository {
+	return &memoryIdempotencyKeys{store: s}
+}
+
+// Transaction restores a copy of the data taken before fn when it fails
+func (s *MemoryStore) Transaction(fn func(store Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.data.copy()
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.data = snapshot
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// WithContext returns the store itself, nothing in memory needs the context
+func (s *MemoryStore) WithContext(ctx context.Context) Store {
+	return s
+}
+
+func (d *memoryData) copy() *memoryData {
+	copied := &memoryData{
+		users:      append([]models.User{}, d.users...),
+		operations: append([]models.Operation{}, d.operations...),
+		records:    append([]models.Record{}, d.records...),
+		tags:       append([]models.Tag{}, d.tags...),
+		recordTags: make(map[uint][]uint, len(d.recordTags)),
+
+		idempotencyKeys: append([]models.IdempotencyKey{}, d.idempotencyKeys...),
+	}
+	for recordID, tagIDs := range d.recordTags {
+		copied.recordTags[recordID] = append([]uint{}, tagIDs...)
+	}
+
+	return copied
+}
+
+type memoryUsers struct {
+	store *MemoryStore
+}
+
+func (r *memoryUsers) WithContext(ctx context.Context) UserRepository {
+	return r
+}
+
+func (r *memoryUsers) Create(user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	data := r.store.data
+	for _, existing := range data.users {
+		if existing.Username == user.Username {
+			return errors.New("username is already taken")
+		}
+	}
+
+	// The same defaults as the database columns
+	if user.Status == "" {
+		user.Status = "active"
+	}
+	if user.Balance == 0 {
+		user.Balance = 50
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	user.ID = uint(len(data.users) + 1)
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	data.users = append(data.users, *user)
+	return nil
+}
+
+func (r *memoryUsers) FindByID(id uint) (models.User, error) {
+	return r.find(func(user models.User) bool { return user.ID == id })
+}
+
+func (r *memoryUsers) FindByUsername(username string) (models.User, error) {
+	return r.find(func(user models.User) bool { return user.Username == username })
+}
+
+func (r *memoryUsers) find(match func(models.User) bool) (models.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, user := range r.store.data.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUsers) Charge(userID uint, amount float64) (float64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i, user := range r.store.data.users {
+		if user.ID == userID {
+			if user.Balance < amount {
+				return user.Balance, ErrInsufficientBalance
+			}
+			r.store.data.users[i].Balance -= amount
+			r.store.data.users[i].UpdatedAt = time.Now()
+			return r.store.data.users[i].Balance, nil
+		}
+	}
+
+	return 0, ErrNotFound
+}
+
+func (r *memoryUsers) Save(user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i, existing := range r.store.data.users {
+		if existing.ID == user.ID {
+			user.UpdatedAt = time.Now()
+			r.store.data.users[i] = *user
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+type memoryIdempotencyKeys struct {
+	store *MemoryStore
+}
+
+func (r *memoryIdempotencyKeys) WithContext(ctx context.Context) IdempotencyKeyRepository {
+	return r
+}
+
+func (r *memoryIdempotencyKeys) Find(userID uint, key string) (models.IdempotencyKey, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, idempotencyKey := range r.store.data.idempotencyKeys {
+		if idempotencyKey.UserID == userID && idempotencyKey.Key == key {
+			return idempotencyKey, nil
+		}
+	}
+
+	return models.IdempotencyKey{}, ErrNotFound
+}
+
+func (r *memoryIdempotencyKeys) Create(key *models.IdempotencyKey) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	data := r.store.data
+	for _, existing := range data.idempotencyKeys {
+		if existing.UserID == key.UserID && existing.Key == key.Key {
+			return errors.New("idempotency key was already used")
+		}
+	}
+
+	key.ID = uint(len(data.idempotencyKeys) + 1)
+	key.CreatedAt = time.Now()
+	data.idempotencyKeys = append(data.idempotencyKeys, *key)
+	return nil
+}
+
+type memoryOperations struct {
+	store *MemoryStore
+}
+
+func (r *memoryOperations) WithContext(ctx context.Context) OperationRepository {
+	return r
+}
+
+func (r *memoryOperations) FindByType(operationType string) (models.Operation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, operation := range r.store.data.operations {
+		if operation.Type == operationType {
+			return operation, nil
+		}
+	}
+
+	return models.Operation{}, ErrNotFound
+}
+
+func (r *memoryOperations) FindOrCreate(operation *models.Operation) error {
+	if existing, err := r.FindByType(operation.Type); err == nil {
+		*operation = existing
+		return nil
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	operation.ID = uint(len(r.store.data.operations) + 1)
+	r.store.data.operations = append(r.store.data.operations, *operation)
+	return nil
+}
+
+type memoryRecords struct {
+	store *MemoryStore
+}
+
+// load fills in the operation and tags of a record, it must be called with the lock held
+func (r *memoryRecords) load(record models.Record) models.Record {
+	data := r.store.data
+	for _, operation := range data.operations {
+		if operation.ID == record.OperationID {
+			record.Operation = operation
+		}
+	}
+
+	record.Tags = []models.Tag{}
+	for _, tagID := range data.recordTags[record.ID] {
+		for _, tag := range data.tags {
+			if tag.ID == tagID {
+				record.Tags = append(record.Tags, tag)
+			}
+		}
+	}
+
+	return record
+}
+
+// matches reports whether the record passes the filter, it must be called with the lock held
+func (r *memoryRecords) matches(record models.Record, filter RecordFilter) bool {
+	if filter.Searching() {
+		search := strings.ToLower(filter.Search)
+		found := false
+		for _, column := range []string{record.OperationResult, models.InputValues(record.Inputs), record.Note} {
+			if strings.Contains(strings.ToLower(column), search) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if filter.Tag != "" {
+		for _, tag := range r.load(record).Tags {
+			if tag.Name == strings.TrimSpace(filter.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func (r *memoryRecords) WithContext(ctx context.Context) RecordRepository {
+	return r
+}
+
+func (r *memoryRecords) Create(record *models.Record) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	data := r.store.data
+	record.ID = uint(len(data.records) + 1)
+	record.CreatedAt = time.Now()
+	record.UpdatedAt = record.CreatedAt
+
+	tagIDs := []uint{}
+	for _, tag := range record.Tags {
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	data.recordTags[record.ID] = tagIDs
+
+	stored := *record
+	stored.Operation = models.Operation{}
+	stored.Tags = nil
+	data.records = append(data.records, stored)
+	return nil
+}
+
+func (r *memoryRecords) FindForUser(userID, recordID uint) (models.Record, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	index, err := r.index(userID, recordID)
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	return r.load(r.store.data.records[index]), nil
+}
+
+// index returns the position of one of the user's records that isn't deleted, it must be called with the lock held
+func (r *memoryRecords) index(userID, recordID uint) (int, error) {
+	for i, record := range r.store.data.records {
+		if record.ID == recordID && record.UserID == userID && !record.DeletedAt.Valid {
+			return i, nil
+		}
+	}
+
+	return 0, ErrNotFound
+}
+
+func (r *memoryRecords) List(userID uint, filter RecordFilter, limit, offset int) (RecordPage, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	page := RecordPage{Records: []models.Record{}}
+	for _, record := range r.store.data.records {
+		if record.UserID != userID || record.DeletedAt.Valid || !r.matches(record, filter) {
+			continue
+		}
+
+		if page.Total >= int64(offset) && len(page.Records) < limit {
+			page.Records = append(page.Records, r.load(record))
+		}
+		page.Total++
+	}
+
+	return page, nil
+}
+
+func (r *memoryRecords) Annotate(record *models.Record, note *string, tags []string) error {
+	var userTags []models.Tag
+	if tags != nil {
+		var err error
+		if userTags, err = r.FindOrCreateTags(record.UserID, tags); err != nil {
+			return err
+		}
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	index, err := r.index(record.UserID, record.ID)
+	if err != nil {
+		return err
+	}
+
+	data := r.store.data
+	if note != nil {
+		data.records[index].Note = *note
+	}
+	if tags != nil {
+		tagIDs := []uint{}
+		for _, tag := range userTags {
+			tagIDs = append(tagIDs, tag.ID)
+		}
+		data.recordTags[record.ID] = tagIDs
+	}
+	data.records[index].UpdatedAt = time.Now()
+
+	*record = r.load(data.records[index])
+	return nil
+}
+
+func (r *memoryRecords) Delete(userID, recordID uint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	index, err := r.index(userID, recordID)
+	if err != nil {
+		return err
+	}
+
+	r.store.data.records[index].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (r *memoryRecords) DeleteMatching(userID uint, ids []uint, filter RecordFilter) ([]uint, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	requested := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		requested[id] = true
+	}
+
+	deleted := []uint{}
+	records := r.store.data.records
+	for i, record := range records {
+		if record.UserID != userID || record.DeletedAt.Valid || (len(ids) > 0 && !requested[record.ID]) {
+			continue
+		}
+		if !r.matches(record, filter) {
+			continue
+		}
+
+		records[i].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		deleted = append(deleted, record.ID)
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryRecords) FindOrCreateTags(userID uint, names []string) ([]models.Tag, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	data := r.store.data
+	tags := []models.Tag{}
+	for _, name := range tagNames(names) {
+		tag := models.Tag{UserID: userID, Name: name}
+		for _, existing := range data.tags {
+			if existing.UserID == userID && existing.Name == name {
+				tag = existing
+			}
+		}
+
+		if tag.ID == 0 {
+			tag.ID = uint(len(data.tags) + 1)
+			data.tags = append(data.tags, tag)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (r *memoryRecords) StatsEntries(query StatsQuery) ([]services.StatsEntry, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	// Deleted records are included since they were still paid for
+	entries := []services.StatsEntry{}
+	for _, record := range r.store.data.records {
+		if query.UserID != 0 && record.UserID != query.UserID {
+			continue
+		}
+		if !query.From.IsZero() && record.CreatedAt.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !record.CreatedAt.Before(query.To) {
+			continue
+		}
+
+		// Like the join with the operations in the database
+		operation := r.load(record).Operation
+		if operation.ID == 0 {
+			continue
+		}
+
+		entries = append(entries, services.StatsEntry{
+			UserID:      record.UserID,
+			Operation:   operation.Type,
+			Amount:      record.Amount,
+			UserBalance: record.UserBalance,
+			CreatedAt:   record.CreatedAt,
+		})
+	}
+
+	// Records are created in order, but a stable sort keeps the order of equal times like the database
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// ErrNotFound is returned when the requested row doesn't exist or belongs to another user
+var ErrNotFound = errors.New("not found")
+
+// ErrInsufficientBalance is returned by Charge when the balance doesn't cover the amount
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// Store gives access to every repository. The controllers only depend on it, so they can run against the
+// database or against the in-memory store in tests
+type Store interface {
+	Users() UserRepository
+	Operations() OperationRepository
+	Records() RecordRepository
+	IdempotencyKeys() IdempotencyKeyRepository
+
+	// Transaction runs fn with a store whose changes are only kept when fn returns nil
+	Transaction(fn func(store Store) error) error
+	// WithContext returns a store whose queries run with ctx, so they are canceled, traced and logged with the
+	// request that makes them
+	WithContext(ctx context.Context) Store
+}
+
+type UserRepository interface {
+	WithContext(ctx context.Context) UserRepository
+	Create(user *models.User) error
+	FindByID(id uint) (models.User, error)
+	FindByUsername(username string) (models.User, error)
+	Save(user *models.User) error
+	// Charge deducts the amount from the user's balance in a single update, so concurrent charges can't overwrite
+	// each other, and returns the new balance. The balance is left as is when it doesn't cover the amount
+	Charge(userID uint, amount float64) (float64, error)
+}
+
+type OperationRepository interface {
+	WithContext(ctx context.Context) OperationRepository
+	FindByType(operationType string) (models.Operation, error)
+	// FindOrCreate loads the operation with the same type, creating it when it doesn't exist
+	FindOrCreate(operation *models.Operation) error
+}
+
+type RecordRepository interface {
+	WithContext(ctx context.Context) RecordRepository
+	// Create saves the record along with its tags
+	Create(record *models.Record) error
+	// FindForUser returns one of the user's records with its operation and tags
+	FindForUser(userID, recordID uint) (models.Record, error)
+	// List returns a page of the user's records matching the filter, with their operations and tags
+	List(userID uint, filter RecordFilter, limit, offset int) (RecordPage, error)
+	// Annotate replaces the note and tags of the record when they are not nil and reloads it
+	Annotate(record *models.Record, note *string, tags []string) error
+	Delete(userID, recordID uint) error
+	// DeleteMatching deletes the user's records with the given IDs, or all of them when ids is empty,
+	// that match the filter, and returns the IDs of the deleted records
+	DeleteMatching(userID uint, ids []uint, filter RecordFilter) ([]uint, error)
+	// FindOrCreateTags returns the user's tags with the given names, creating the missing ones.
+	// Names are trimmed and duplicates or empty names are ignored
+	FindOrCreateTags(userID uint, names []string) ([]models.Tag, error)
+	// StatsEntries returns the billed operations, deleted records included, sorted by creation time
+	StatsEntries(query StatsQuery) ([]services.StatsEntry, error)
+}
+
+type IdempotencyKeyRepository interface {
+	WithContext(ctx context.Context) IdempotencyKeyRepository
+	// Find returns the key the user sent, or ErrNotFound
+	Find(userID uint, key string) (models.IdempotencyKey, error)
+	// Create saves the key, it fails when the user already used it
+	Create(key *models.IdempotencyKey) error
+}
+
+// RecordFilter holds the filters that can be applied to a user's records.
+// It is bound from the query string in GetRecords and from the JSON body in BulkDeleteRecords
+type RecordFilter struct {
+	Search string `form:"search" json:"search"`
+	Tag    string `form:"tag" json:"tag"`
+}
+
+// IsEmpty reports whether no filter has been set
+func (f RecordFilter) IsEmpty() bool {
+	return !f.Searching() && f.Tag == ""
+}
+
+// Searching reports whether the filter contains a search term
+func (f RecordFilter) Searching() bool {
+	return strings.TrimSpace(f.Search) != ""
+}
+
+// RecordPage is a page of records and the total number of records matching the filter
+type RecordPage struct {
+	Records []models.Record
+	Total   int64
+	// Snippets highlight the matches of each record, they are only set when full-text search ranked the records
+	Snippets map[uint]string
+}
+
+// StatsQuery selects the records used for the usage statistics
+type StatsQuery struct {
+	UserID uint      // zero for every user
+	From   time.Time // inclusive, zero for no lower bound
+	To     time.Time // exclusive, zero for no upper bound
+}
+
+// tagNames trims the names and drops empty and duplicated ones
+func tagNames(names []string) []string {
+	unique := []string{}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, name)
+	}
+
+	return unique
+}
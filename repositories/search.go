@@ -0,0 +1,40 @@
+package repositories
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MatchExpression turns free text from a user into a safe FTS5 query.
+// Every word is quoted so FTS5 operators are not interpreted, and matched as a prefix
+func MatchExpression(search string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(search) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// SearchSnippets returns a highlighted snippet of the best matching column for each of the given records
+func SearchSnippets(db *gorm.DB, search string, recordIDs []uint) (map[uint]string, error) {
+	var rows []struct {
+		RecordID uint
+		Snippet  string
+	}
+
+	err := db.Raw(`SELECT rowid AS record_id, snippet(records_fts, -1, '<mark>', '</mark>', '…', 10) AS snippet
+		FROM records_fts WHERE records_fts MATCH ? AND rowid IN ?`, MatchExpression(search), recordIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	snippets := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		snippets[row.RecordID] = row.Snippet
+	}
+
+	return snippets, nil
+}
@@ -0,0 +1,287 @@
+package repositories_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/database"
+	"github.com/ricardofabila/arithmetic-calculator-backend/database/testdb"
+	"github.com/ricardofabila/arithmetic-calculator-backend/models"
+	"github.com/ricardofabila/arithmetic-calculator-backend/repositories"
+)
+
+// TestMain stops the embedded PostgreSQL server once the tests are done, see testdb.Main
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m))
+}
+
+// runStoreTest runs the test against the in-memory store and every database backend, each with a user
+// and the seeded operations, so the in-memory store used by the controller tests is held to the same behavior
+func runStoreTest(t *testing.T, test func(t *testing.T, store repositories.Store, user models.User)) {
+	testdb.Run(t, func(t *testing.T, store repositories.Store) {
+		if err := database.SeedOperations(store.Operations()); err != nil {
+			t.Fatalf("unexpected error seeding operations: %v", err)
+		}
+
+		user := models.User{Username: "testuser@example.com", Password: "password123", Balance: 100}
+		if err := store.Users().Create(&user); err != nil {
+			t.Fatalf("unexpected error creating the user: %v", err)
+		}
+
+		test(t, store, user)
+	})
+}
+
+func TestUsers(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		if user.ID == 0 || user.Role != models.RoleUser || user.Status != "active" {
+			t.Errorf("expected an ID and the default role and status, got %+v", user)
+		}
+
+		if err := store.Users().Create(&models.User{Username: user.Username, Password: "other"}); err == nil {
+			t.Error("expected an error for a duplicated username, but got nil")
+		}
+
+		user.Balance = 42
+		if err := store.Users().Save(&user); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		found, err := store.Users().FindByUsername(user.Username)
+		if err != nil || found.ID != user.ID || found.Balance != 42 {
+			t.Errorf("expected the saved user, got %+v, %v", found, err)
+		}
+
+		if _, err := store.Users().FindByID(999); !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestUsers_Charge(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		balance, err := store.Users().Charge(user.ID, 2.5)
+		if err != nil || balance != 97.5 {
+			t.Fatalf("expected balance 97.5, got %v, %v", balance, err)
+		}
+		if _, err := store.Users().Charge(user.ID, 1000); !errors.Is(err, repositories.ErrInsufficientBalance) {
+			t.Errorf("expected ErrInsufficientBalance, got %v", err)
+		}
+		if saved, _ := store.Users().FindByID(user.ID); saved.Balance != 97.5 {
+			t.Errorf("expected the refused charge to leave the balance as is, got %v", saved.Balance)
+		}
+		if _, err := store.Users().Charge(999, 1); err == nil {
+			t.Error("expected an error charging a missing user, but got nil")
+		}
+	})
+}
+
+// TestUsers_ConcurrentCharges tests that concurrent charges are all applied and never take the balance below zero
+func TestUsers_ConcurrentCharges(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		if !testdb.Isolated(path.Base(t.Name())) {
+			t.Skip("the MySQL stand-in doesn't isolate concurrent updates")
+		}
+
+		var wg sync.WaitGroup
+		var charged, refused atomic.Int64
+		for i := 0; i < 120; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.Users().Charge(user.ID, 1)
+				switch {
+				case err == nil:
+					charged.Add(1)
+				case errors.Is(err, repositories.ErrInsufficientBalance):
+					refused.Add(1)
+				default:
+					t.Errorf("unexpected error charging: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		saved, _ := store.Users().FindByID(user.ID)
+		if charged.Load() != 100 || refused.Load() != 20 || saved.Balance != 0 {
+			t.Errorf("expected 100 charges and balance 0, got %d charges, %d refused and balance %v", charged.Load(), refused.Load(), saved.Balance)
+		}
+	})
+}
+
+func TestRecords_ListAndFilter(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		records := store.Records()
+		tags, err := records.FindOrCreateTags(user.ID, []string{"invoices", " invoices ", ""})
+		if err != nil || len(tags) != 1 {
+			t.Fatalf("expected a single tag, got %v, %v", tags, err)
+		}
+
+		records.Create(&models.Record{UserID: user.ID, OperationID: 1, OperationResult: "8", Note: "Invoice check", Tags: tags})
+		records.Create(&models.Record{UserID: user.ID, OperationID: 1, OperationResult: "9"})
+		records.Create(&models.Record{UserID: user.ID + 1, OperationID: 1, OperationResult: "80"})
+
+		page, err := records.List(user.ID, repositories.RecordFilter{}, 1, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if page.Total != 2 || len(page.Records) != 1 || page.Records[0].OperationResult != "9" {
+			t.Errorf("expected the second of the user's 2 records, got %+v", page)
+		}
+		if page.Records[0].Operation.Type != "addition" {
+			t.Errorf("expected the operation to be loaded, got %+v", page.Records[0].Operation)
+		}
+
+		page, _ = records.List(user.ID, repositories.RecordFilter{Search: "invoice"}, 10, 0)
+		if page.Total != 1 || page.Records[0].OperationResult != "8" {
+			t.Errorf("expected the annotated record, got %+v", page.Records)
+		}
+
+		// Search is case-insensitive and the LIKE wildcards are matched literally
+		page, _ = records.List(user.ID, repositories.RecordFilter{Search: "INVOICE"}, 10, 0)
+		if page.Total != 1 {
+			t.Errorf("expected a case-insensitive match, got %+v", page.Records)
+		}
+		page, _ = records.List(user.ID, repositories.RecordFilter{Search: "%"}, 10, 0)
+		if page.Total != 0 {
+			t.Errorf("expected no record to contain %%, got %+v", page.Records)
+		}
+
+		page, _ = records.List(user.ID, repositories.RecordFilter{Tag: "invoices"}, 10, 0)
+		if page.Total != 1 || len(page.Records[0].Tags) != 1 {
+			t.Errorf("expected the tagged record with its tag, got %+v", page.Records)
+		}
+
+		if _, err := records.FindForUser(user.ID, 3); !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for another user's record, got %v", err)
+		}
+	})
+}
+
+func TestRecords_AnnotateAndDelete(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		records := store.Records()
+		for _, result := range []string{"1", "2", "3"} {
+			records.Create(&models.Record{UserID: user.ID, OperationID: 1, OperationResult: result, Amount: 1})
+		}
+
+		record, _ := records.FindForUser(user.ID, 1)
+		note := "checked"
+		if err := records.Annotate(&record, &note, []string{"q3"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if record.Note != "checked" || len(record.Tags) != 1 || record.Tags[0].Name != "q3" {
+			t.Errorf("expected the note and tag to be set, got %+v", record)
+		}
+
+		if err := records.Delete(user.ID, 2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := records.Delete(user.ID, 2); !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a deleted record, got %v", err)
+		}
+
+		deleted, err := records.DeleteMatching(user.ID, []uint{1, 2, 3}, repositories.RecordFilter{Tag: "q3"})
+		if err != nil || len(deleted) != 1 || deleted[0] != 1 {
+			t.Errorf("expected only the tagged record to be deleted, got %v, %v", deleted, err)
+		}
+
+		// Deleted records still count in the statistics since they were paid for
+		entries, err := records.StatsEntries(repositories.StatsQuery{UserID: user.ID})
+		if err != nil || len(entries) != 3 {
+			t.Errorf("expected 3 stats entries, got %v, %v", entries, err)
+		}
+
+		entries, _ = records.StatsEntries(repositories.StatsQuery{To: time.Now().Add(-time.Hour)})
+		if len(entries) != 0 {
+			t.Errorf("expected no entries before the records were created, got %v", entries)
+		}
+	})
+}
+
+// TestRecords_SearchInputs tests that the values of the inputs are searched but not their names
+func TestRecords_SearchInputs(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		records := store.Records()
+		records.Create(&models.Record{UserID: user.ID, OperationID: 1, OperationResult: "8", Inputs: `{"number1":5,"number2":3}`})
+		records.Create(&models.Record{UserID: user.ID, OperationID: 1, OperationResult: "q", Inputs: `{"length":1,"charset":{"digits":false,"custom":"xyz"}}`})
+
+		for search, expected := range map[string]int64{"number": 0, "length": 0, "digits": 0, "false": 0, "5": 1, "xyz": 1} {
+			page, err := records.List(user.ID, repositories.RecordFilter{Search: search}, 10, 0)
+			if err != nil || page.Total != expected {
+				t.Errorf("expected %d records matching %q, got %d, %v", expected, search, page.Total, err)
+			}
+		}
+	})
+}
+
+func TestStore_Transaction(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		failure := errors.New("failure")
+		err := store.Transaction(func(tx repositories.Store) error {
+			user.Balance = 0
+			tx.Users().Save(&user)
+			tx.Records().Create(&models.Record{UserID: user.ID, OperationID: 1})
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("expected the error of the transaction, got %v", err)
+		}
+
+		saved, _ := store.Users().FindByID(user.ID)
+		page, _ := store.Records().List(user.ID, repositories.RecordFilter{}, 10, 0)
+		if saved.Balance != 100 || page.Total != 0 {
+			t.Errorf("expected the changes to be rolled back, got balance %v and %d records", saved.Balance, page.Total)
+		}
+	})
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store repositories.Store, user models.User) {
+		key := models.IdempotencyKey{UserID: user.ID, Key: "key-1", RequestHash: "hash", RecordID: 1, StatusCode: 200, Response: `{"result":"3"}`}
+		if err := store.IdempotencyKeys().Create(&key); err != nil || key.ID == 0 {
+			t.Fatalf("expected the key to be created, got %+v, %v", key, err)
+		}
+
+		found, err := store.IdempotencyKeys().Find(user.ID, "key-1")
+		if err != nil || found.RequestHash != "hash" || found.Response != key.Response {
+			t.Errorf("expected the created key, got %+v, %v", found, err)
+		}
+
+		if err := store.IdempotencyKeys().Create(&models.IdempotencyKey{UserID: user.ID, Key: "key-1", RequestHash: "other"}); err == nil {
+			t.Error("expected an error for a duplicated key, but got nil")
+		}
+
+		// Keys are scoped to the user
+		if _, err := store.IdempotencyKeys().Find(user.ID+1, "key-1"); !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for another user, got %v", err)
+		}
+	})
+}
+
+// TestGormStore_SearchSnippets tests the ranking snippets, which are only available with full-text search
+func TestGormStore_SearchSnippets(t *testing.T) {
+	connection := testdb.Open(t, testdb.SQLite)
+	if !connection.FullTextSearch {
+		t.Skip("full-text search needs the sqlite_fts5 build tag")
+	}
+
+	store := connection.Store()
+	database.SeedOperations(store.Operations())
+	store.Records().Create(&models.Record{UserID: 1, OperationID: 1, OperationResult: "8", Note: "invoice check"})
+
+	page, err := store.Records().List(1, repositories.RecordFilter{Search: "invoice"}, 10, 0)
+	if err != nil || len(page.Records) != 1 {
+		t.Fatalf("expected the matching record, got %+v, %v", page, err)
+	}
+
+	expectedSnippet := "<mark>invoice</mark> check"
+	if page.Snippets[page.Records[0].ID] != expectedSnippet {
+		t.Errorf("expected snippet %q, got %q", expectedSnippet, page.Snippets[page.Records[0].ID])
+	}
+}
@@ -1,35 +1,75 @@
 package routes
 
 import (
+	"log/slog"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
 	"github.com/ricardofabila/arithmetic-calculator-backend/controllers"
+	"github.com/ricardofabila/arithmetic-calculator-backend/metrics"
 	"github.com/ricardofabila/arithmetic-calculator-backend/middlewares"
 )
 
-func SetupRouter(operationController *controllers.OperationController) *gin.Engine {
-	router := gin.Default()
+// Controllers are the handlers of every route, built with their dependencies in main
+type Controllers struct {
+	User      *controllers.UserController
+	Operation *controllers.OperationController
+	Record    *controllers.RecordController
+	Stats     *controllers.StatsController
+	Health    *controllers.HealthController
+}
+
+// SetupRouter builds the router, the routes are rate limited by limiter
+func SetupRouter(cfg *config.Config, handlers Controllers, m *metrics.Metrics, logger *slog.Logger, limiter *middlewares.RateLimiter) (*gin.Engine, error) {
+	// Requests are logged by the structured logger instead of gin's text logger, along with their trace ID
+	router := gin.New()
+	// The client IP is used to rate limit the public routes, only the proxies in front of the server may set it
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	router.Use(
+		middlewares.TracingMiddleware(cfg.Tracing.ServiceName),
+		middlewares.RequestLoggerMiddleware(logger),
+		middlewares.RecoveryMiddleware(),
+		middlewares.MetricsMiddleware(m),
+	)
 
-	config := cors.DefaultConfig()
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "Accept", "User-Agent", "Cache-Control", "Pragma"}
-	config.ExposeHeaders = []string{"Content-Length"}
-	config.AllowAllOrigins = true
-	config.AllowCredentials = true
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowHeaders = cfg.CORS.AllowedHeaders
+	corsConfig.ExposeHeaders = cfg.CORS.ExposedHeaders
+	if cfg.CORS.AllowsAllOrigins() {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.CORS.AllowedOrigins
+	}
+	corsConfig.AllowCredentials = cfg.CORS.AllowCredentials
 
-	corsMiddleware := cors.New(config)
+	corsMiddleware := cors.New(corsConfig)
 	router.Use(corsMiddleware)
 
-	// Public Routes
-	router.POST("/register", controllers.RegisterUser)
-	router.POST("/login", controllers.LoginUser)
+	// Public Routes, the probes and the metrics aren't rate limited
+	router.GET("/health", handlers.Health.Health)
+	router.GET("/healthz", handlers.Health.Liveness)
+	router.GET("/readyz", handlers.Health.Readiness)
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	public := router.Group("", limiter.ByIP())
+	public.POST("/register", handlers.User.RegisterUser)
+	public.POST("/login", handlers.User.LoginUser)
 
 	// Protected Routes
 	api := router.Group("/api/v1")
-	api.Use(middlewares.JWTAuthMiddleware())
+	api.Use(middlewares.JWTAuthMiddleware([]byte(cfg.Auth.JWTSecret)), limiter.ByUser())
 
-	api.POST("/operation", operationController.PerformOperation)
-	api.GET("/records", controllers.GetRecords)
-	api.DELETE("/records/:id", controllers.DeleteRecord)
+	api.POST("/operation", handlers.Operation.PerformOperation)
+	api.POST("/operations/batch", handlers.Operation.PerformBatch)
+	api.GET("/records", handlers.Record.GetRecords)
+	api.PATCH("/records/:id", handlers.Record.UpdateRecord)
+	api.DELETE("/records/:id", handlers.Record.DeleteRecord)
+	api.POST("/records/bulk-delete", handlers.Record.BulkDeleteRecords)
+	api.POST("/records/:id/replay", handlers.Operation.ReplayRecord)
+	api.GET("/stats", handlers.Stats.GetStats)
 
-	return router
+	return router, nil
 }
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops calling a failing dependency for a while.
+// It opens after Threshold consecutive failures (a Threshold of zero disables it) and lets a single trial call through once Cooldown has passed,
+// closing again if that call succeeds
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	Now       func() time.Time // defaults to time.Now, replaceable in tests
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+func (b *CircuitBreaker) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+
+	return time.Now()
+}
+
+// Allow reports whether a call can be made
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Threshold <= 0 || b.failures < b.Threshold {
+		return true
+	}
+
+	// Half-open: only one trial call at a time after the cooldown
+	if !b.trial && b.now().Sub(b.openedAt) >= b.Cooldown {
+		b.trial = true
+		return true
+	}
+
+	return false
+}
+
+// IsOpen reports whether calls are currently being refused
+func (b *CircuitBreaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
+
+// Success records a successful call and closes the breaker
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+}
+
+// Failure records a failed call, opening the breaker once the threshold is reached
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.Threshold > 0 && b.failures >= b.Threshold {
+		b.openedAt = b.now()
+	}
+}
+
+// Abandoned records a call given up by its caller, which says nothing about the dependency. A trial call can be made
+// again, and the failures are left as they are
+func (b *CircuitBreaker) Abandoned() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
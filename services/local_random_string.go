@@ -0,0 +1,80 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+// maxUniqueAttempts bounds how many times duplicated strings are regenerated
+const maxUniqueAttempts = 10
+
+// LocalRandomStringService generates random strings with crypto/rand, it doesn't need network access
+type LocalRandomStringService struct{}
+
+func (l *LocalRandomStringService) GetRandomString(length int) (string, error) {
+	results, err := l.GetRandomStrings(DefaultRandomStringOptions(length))
+	if err != nil {
+		return "", err
+	}
+
+	return results[0], nil
+}
+
+func (l *LocalRandomStringService) GetRandomStrings(options RandomStringOptions) ([]string, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	characters := options.Characters()
+	return generateStrings(options, func() (string, error) {
+		return randomString(characters, options.Length)
+	})
+}
+
+func (l *LocalRandomStringService) Status() ProviderStatus {
+	return ProviderStatus{Provider: "local", Status: "ok"}
+}
+
+// randomString draws length characters uniformly with crypto/rand
+func randomString(characters []rune, length int) (string, error) {
+	max := big.NewInt(int64(len(characters)))
+	result := make([]rune, length)
+	for i := range result {
+		// rand.Int is uniform, unlike taking a random byte modulo the alphabet size
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		result[i] = characters[n.Int64()]
+	}
+
+	return string(result), nil
+}
+
+// generateStrings calls generate until it has options.Count strings, regenerating duplicates when they must be unique
+func generateStrings(options RandomStringOptions, generate func() (string, error)) ([]string, error) {
+	results := make([]string, 0, options.Count)
+	seen := make(map[string]bool, options.Count)
+	attempts := 0
+	for len(results) < options.Count {
+		result, err := generate()
+		if err != nil {
+			return nil, err
+		}
+
+		if options.Unique && seen[result] {
+			// Validate guarantees enough combinations, but a tiny space can still take a while to fill
+			attempts++
+			if attempts > maxUniqueAttempts*options.Count {
+				return nil, errors.New("could not generate enough unique strings")
+			}
+			continue
+		}
+
+		seen[result] = true
+		results = append(results, result)
+	}
+
+	return results, nil
+}
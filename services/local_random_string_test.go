@@ -0,0 +1,37 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// TestLocalRandomStringLength tests that the generated string has the requested length and alphabet
+func TestLocalRandomStringLength(t *testing.T) {
+	service := &services.LocalRandomStringService{}
+
+	result, err := service.GetRandomString(20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result) != 20 {
+		t.Errorf("expected a string of length 20, but got %q", result)
+	}
+
+	for _, char := range result {
+		if !strings.ContainsRune("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", char) {
+			t.Errorf("unexpected character %q in %q", char, result)
+		}
+	}
+}
+
+// TestLocalRandomStringInvalidLength tests that a non-positive length is rejected
+func TestLocalRandomStringInvalidLength(t *testing.T) {
+	service := &services.LocalRandomStringService{}
+
+	if _, err := service.GetRandomString(0); err == nil {
+		t.Errorf("expected an error for length 0, but got nil")
+	}
+}
@@ -1,7 +0,0 @@
-package services
-
-type MockRandomStringService struct{}
-
-func (m *MockRandomStringService) GetRandomString(length int) (string, error) {
-	return "MOCKSTRING", nil
-}
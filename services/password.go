@@ -0,0 +1,229 @@
+package services
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	symbols = "!@#$%^&*()-_=+[]{};:,.<>?/~"
+	// ambiguousCharacters are easily confused when a password is read or typed
+	ambiguousCharacters = "Il1|O0o`'\""
+
+	MinPasswordLength   = 4
+	MaxPasswordLength   = 128
+	MinPassphraseWords  = 3
+	MaxPassphraseWords  = 20
+	maxPasswordAttempts = 100
+)
+
+// passwordClasses are the character classes a password can be made of
+var passwordClasses = map[string]string{
+	"digits":  digits,
+	"upper":   upperAlpha,
+	"lower":   lowerAlpha,
+	"symbols": symbols,
+}
+
+// PasswordPolicy describes the passwords to generate
+type PasswordPolicy struct {
+	Length           int
+	Classes          []string // character classes used, all of them when empty
+	Required         []string // classes that must appear at least once, the used classes when nil
+	ExcludeAmbiguous bool
+}
+
+func (p PasswordPolicy) classes() []string {
+	if len(p.Classes) == 0 {
+		return []string{"digits", "upper", "lower", "symbols"}
+	}
+
+	return p.Classes
+}
+
+func (p PasswordPolicy) required() []string {
+	if p.Required == nil {
+		return p.classes()
+	}
+
+	return p.Required
+}
+
+// characters returns the characters of a class, without the ambiguous ones when they are excluded
+func (p PasswordPolicy) characters(class string) string {
+	if !p.ExcludeAmbiguous {
+		return passwordClasses[class]
+	}
+
+	return strings.Map(func(char rune) rune {
+		if strings.ContainsRune(ambiguousCharacters, char) {
+			return -1
+		}
+		return char
+	}, passwordClasses[class])
+}
+
+// Alphabet returns every character a password can contain, each of them once
+func (p PasswordPolicy) Alphabet() string {
+	var alphabet strings.Builder
+	for _, class := range p.classes() {
+		for _, char := range p.characters(class) {
+			if !strings.ContainsRune(alphabet.String(), char) {
+				alphabet.WriteRune(char)
+			}
+		}
+	}
+
+	return alphabet.String()
+}
+
+func (p PasswordPolicy) Validate() error {
+	if p.Length < MinPasswordLength || p.Length > MaxPasswordLength {
+		return fmt.Errorf("password length must be between %d and %d", MinPasswordLength, MaxPasswordLength)
+	}
+
+	used := map[string]bool{}
+	for _, class := range p.classes() {
+		if _, ok := passwordClasses[class]; !ok {
+			return fmt.Errorf("unknown character class %q, use digits, upper, lower or symbols", class)
+		}
+		if used[class] {
+			return fmt.Errorf("character class %q is listed twice", class)
+		}
+		used[class] = true
+	}
+
+	required := map[string]bool{}
+	for _, class := range p.required() {
+		if !used[class] {
+			return fmt.Errorf("required character class %q is not used", class)
+		}
+		if required[class] {
+			return fmt.Errorf("required character class %q is listed twice", class)
+		}
+		required[class] = true
+	}
+
+	if len(p.required()) > p.Length {
+		return errors.New("the password is too short to contain every required character class")
+	}
+
+	return nil
+}
+
+// EntropyBits is the entropy of a password drawn uniformly from the passwords of the policy, log2 of their number.
+// Of the size^length strings of the alphabet only those with every required class are kept, they are counted by
+// inclusion-exclusion over the sets of required classes left out, as a fraction of all of them
+func (p PasswordPolicy) EntropyBits() float64 {
+	size := float64(len([]rune(p.Alphabet())))
+	required := p.required()
+
+	kept := 0.0
+	for subset := 0; subset < 1<<len(required); subset++ {
+		left, sign := size, 1.0
+		for i, class := range required {
+			if subset&(1<<i) != 0 {
+				left -= float64(len([]rune(p.characters(class))))
+				sign = -sign
+			}
+		}
+		kept += sign * math.Pow(math.Max(left, 0)/size, float64(p.Length))
+	}
+
+	return roundBits(float64(p.Length)*math.Log2(size) + math.Log2(kept))
+}
+
+// GeneratePassword draws passwords from the whole alphabet until one contains every required class.
+// Rejecting the others keeps every valid password equally likely
+func GeneratePassword(source RandomNumberService, policy PasswordPolicy) (string, error) {
+	if err := policy.Validate(); err != nil {
+		return "", err
+	}
+
+	alphabet := []rune(policy.Alphabet())
+	for attempt := 0; attempt < maxPasswordAttempts; attempt++ {
+		indexes, err := source.GetRandomIntegers(0, int64(len(alphabet)-1), policy.Length)
+		if err != nil {
+			return "", err
+		}
+
+		password := make([]rune, len(indexes))
+		for i, index := range indexes {
+			password[i] = alphabet[index]
+		}
+
+		if policy.satisfiedBy(string(password)) {
+			return string(password), nil
+		}
+	}
+
+	return "", errors.New("could not generate a password matching the policy")
+}
+
+func (p PasswordPolicy) satisfiedBy(password string) bool {
+	for _, class := range p.required() {
+		if !strings.ContainsAny(password, p.characters(class)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//go:embed wordlists/eff_large_wordlist.txt
+var effLargeWordlist string
+
+// Wordlist is EFF's large wordlist for passphrases, https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases
+var Wordlist = strings.Fields(effLargeWordlist)
+
+// PassphraseOptions describes the passphrases to generate
+type PassphraseOptions struct {
+	Words      int
+	Separator  string
+	Capitalize bool
+}
+
+func (o PassphraseOptions) Validate() error {
+	if o.Words < MinPassphraseWords || o.Words > MaxPassphraseWords {
+		return fmt.Errorf("a passphrase must have between %d and %d words", MinPassphraseWords, MaxPassphraseWords)
+	}
+
+	return nil
+}
+
+// EntropyBits is the entropy of a passphrase with words drawn uniformly from the wordlist
+func (o PassphraseOptions) EntropyBits() float64 {
+	return roundBits(float64(o.Words) * math.Log2(float64(len(Wordlist))))
+}
+
+func GeneratePassphrase(source RandomNumberService, options PassphraseOptions) (string, error) {
+	if err := options.Validate(); err != nil {
+		return "", err
+	}
+
+	indexes, err := source.GetRandomIntegers(0, int64(len(Wordlist)-1), options.Words)
+	if err != nil {
+		return "", err
+	}
+
+	words := make([]string, len(indexes))
+	for i, index := range indexes {
+		words[i] = Wordlist[index]
+		if options.Capitalize {
+			runes := []rune(words[i])
+			runes[0] = unicode.ToUpper(runes[0])
+			words[i] = string(runes)
+		}
+	}
+
+	return strings.Join(words, options.Separator), nil
+}
+
+// roundBits rounds the entropy to two decimals for display
+func roundBits(bits float64) float64 {
+	return math.Round(bits*100) / 100
+}
@@ -0,0 +1,108 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// TestPasswordPolicy_Validate tests the rejected policies
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policies := []services.PasswordPolicy{
+		{Length: 3},
+		{Length: 129},
+		{Length: 16, Classes: []string{"emoji"}},
+		{Length: 16, Classes: []string{"digits"}, Required: []string{"upper"}},
+		{Length: 4, Classes: []string{"digits", "upper", "lower", "symbols"}, Required: []string{"digits", "upper", "lower", "symbols", "digits"}},
+		{Length: 16, Classes: []string{"digits", "digits"}},
+		{Length: 16, Classes: []string{"digits", "upper"}, Required: []string{"upper", "upper"}},
+	}
+
+	for _, policy := range policies {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("expected an error for %+v, but got nil", policy)
+		}
+	}
+
+	if err := (services.PasswordPolicy{Length: 16}).Validate(); err != nil {
+		t.Errorf("unexpected error for the default classes: %v", err)
+	}
+}
+
+// TestGeneratePassword tests that passwords contain every required class and no ambiguous characters
+func TestGeneratePassword(t *testing.T) {
+	source := &services.LocalRandomStringService{}
+	policy := services.PasswordPolicy{Length: 8, ExcludeAmbiguous: true}
+
+	for i := 0; i < 50; i++ {
+		password, err := services.GeneratePassword(source, policy)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(password) != 8 {
+			t.Errorf("expected a password of length 8, got %q", password)
+		}
+		for _, class := range []string{"0123456789", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "abcdefghijklmnopqrstuvwxyz", "!@#$%^&*()-_=+[]{};:,.<>?/~"} {
+			if !strings.ContainsAny(password, class) {
+				t.Errorf("expected %q to contain one of %q", password, class)
+			}
+		}
+		if strings.ContainsAny(password, "Il1O0o") {
+			t.Errorf("expected %q not to contain ambiguous characters", password)
+		}
+	}
+}
+
+// TestPasswordPolicy_EntropyBits tests the entropy of the alphabet with and without ambiguous characters, and that
+// the passwords missing a required class aren't counted
+func TestPasswordPolicy_EntropyBits(t *testing.T) {
+	if bits := (services.PasswordPolicy{Length: 10, Classes: []string{"digits"}}).EntropyBits(); bits != 33.22 {
+		t.Errorf("expected 33.22 bits, got %v", bits)
+	}
+
+	// Without 0 and 1 only 8 digits are left, 3 bits each
+	policy := services.PasswordPolicy{Length: 10, Classes: []string{"digits"}, ExcludeAmbiguous: true}
+	if bits := policy.EntropyBits(); bits != 30 {
+		t.Errorf("expected 30 bits, got %v", bits)
+	}
+
+	if alphabet := (services.PasswordPolicy{Length: 4, Classes: []string{"digits", "digits"}}).Alphabet(); alphabet != "0123456789" {
+		t.Errorf("expected every digit once, got %q", alphabet)
+	}
+	// Of the 36^2 strings of digits and letters, the 10*26*2 with a digit and a letter are kept
+	policy = services.PasswordPolicy{Length: 2, Classes: []string{"digits", "upper"}}
+	if bits := policy.EntropyBits(); bits != 9.02 {
+		t.Errorf("expected log2(10*26*2) = 9.02 bits, got %v", bits)
+	}
+	policy.Required = []string{}
+	if bits := policy.EntropyBits(); bits != 10.34 {
+		t.Errorf("expected log2(36^2) = 10.34 bits without required classes, got %v", bits)
+	}
+}
+
+// TestGeneratePassphrase tests the words, separator and capitalization of a passphrase
+func TestGeneratePassphrase(t *testing.T) {
+	if len(services.Wordlist) != 7776 {
+		t.Fatalf("expected 7776 words in the wordlist, got %d", len(services.Wordlist))
+	}
+
+	source := &fixedNumberService{integers: []int64{0, 1, 7775}}
+	passphrase, err := services.GeneratePassphrase(source, services.PassphraseOptions{Words: 3, Separator: " ", Capitalize: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "Abacus Abdomen Zoom"
+	if passphrase != expected {
+		t.Errorf("expected %q, got %q", expected, passphrase)
+	}
+
+	if bits := (services.PassphraseOptions{Words: 6}).EntropyBits(); bits != 77.55 {
+		t.Errorf("expected 77.55 bits for 6 words, got %v", bits)
+	}
+
+	if _, err := services.GeneratePassphrase(source, services.PassphraseOptions{Words: 2}); err == nil {
+		t.Error("expected an error for 2 words, but got nil")
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/config"
+)
+
+// RandomProviders are the random services selected by the configuration, the same provider serves the strings
+// and the numbers
+type RandomProviders struct {
+	Strings RandomStringService
+	Numbers RandomNumberService
+	Pool    *RandomStringPool // pre-fetches random.org strings, nil unless pool lengths are configured
+}
+
+// NewRandomProviders creates the provider chosen in the configuration. The pool is returned stopped.
+// The observer, which can be nil, is told about the calls to random.org
+func NewRandomProviders(cfg config.RandomConfig, observer RandomOrgObserver) RandomProviders {
+	switch cfg.Provider {
+	case "local":
+		local := &LocalRandomStringService{}
+		return RandomProviders{Strings: local, Numbers: local}
+	case "seeded":
+		seeded := NewSeededRandomStringService(cfg.Seed)
+		return RandomProviders{Strings: seeded, Numbers: seeded}
+	}
+
+	options := DefaultRandomOrgOptions()
+	options.BaseURL = cfg.RandomOrg.URL
+	options.Timeout = time.Duration(cfg.RandomOrg.Timeout)
+	options.RetryCount = cfg.RandomOrg.Retries
+	options.QuotaMinimumBits = cfg.RandomOrg.QuotaMinBits
+	options.Observer = observer
+	if cfg.RandomOrg.Fallback == "local" {
+		options.Fallback = &LocalRandomStringService{}
+	}
+
+	realRandomStringService := NewRealRandomStringService(options)
+	providers := RandomProviders{Strings: realRandomStringService, Numbers: realRandomStringService}
+	if len(cfg.PoolLengths) > 0 {
+		providers.Pool = NewRandomStringPool(realRandomStringService, cfg.PoolLengths, 100, 20)
+		providers.Strings = providers.Pool
+	}
+
+	return providers
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExhausted = errors.New("random.org quota is exhausted, please try again later")
+
+// RandomOrgQuota keeps track of the bits left in the random.org quota of this IP.
+// The quota is fetched from random.org at most once per TTL, and lowered locally in between as bits are used.
+// It is fetched by one request at a time and without holding the lock, so the others and the status don't wait for it
+type RandomOrgQuota struct {
+	Client      *resty.Client
+	BaseURL     string
+	TTL         time.Duration
+	MinimumBits int64             // requests that would leave fewer bits than this are refused
+	Observer    RandomOrgObserver // optional
+
+	mu         sync.Mutex
+	bits       int64
+	checkedAt  time.Time
+	err        error
+	refreshing chan struct{} // closed once the fetch in progress is done, nil when there is none
+}
+
+type QuotaStatus struct {
+	BitsRemaining int64     `json:"bitsRemaining"`
+	CheckedAt     time.Time `json:"checkedAt"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// requiredBits is the randomness needed for a string of the given length drawn from an alphabet of the given size
+func requiredBits(length, alphabetSize int) int64 {
+	return int64(math.Ceil(float64(length) * math.Log2(float64(alphabetSize))))
+}
+
+// expired reports whether the cached quota must be fetched again, it must be called with the lock held
+func (q *RandomOrgQuota) expired() bool {
+	return q.checkedAt.IsZero() || time.Since(q.checkedAt) >= q.TTL
+}
+
+// refresh fetches the quota with ctx when the cached value has expired. The callers arriving during a fetch wait for
+// it instead of starting another one, until their own ctx is done
+func (q *RandomOrgQuota) refresh(ctx context.Context) {
+	q.mu.Lock()
+	if !q.expired() {
+		q.mu.Unlock()
+		return
+	}
+	if q.refreshing != nil {
+		done := q.refreshing
+		q.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		return
+	}
+	done := make(chan struct{})
+	q.refreshing = done
+	q.mu.Unlock()
+
+	bits, err := q.fetch(ctx)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.refreshing = nil
+	close(done)
+
+	// A canceled request says nothing about random.org, the next one fetches the quota again
+	if ctx.Err() != nil {
+		return
+	}
+	q.checkedAt, q.err = time.Now(), err
+	if err == nil {
+		q.bits = bits
+	}
+}
+
+// fetch asks random.org for the quota of this IP
+func (q *RandomOrgQuota) fetch(ctx context.Context) (bits int64, err error) {
+	baseURL := q.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultRandomOrgURL
+	}
+
+	if q.Observer != nil {
+		start := time.Now()
+		defer func() {
+			q.Observer.ObserveRandomOrgCall("quota", time.Since(start), err)
+		}()
+	}
+
+	resp, err := q.Client.R().SetContext(ctx).Get(strings.TrimSuffix(baseURL, "/") + "/quota/?format=plain")
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode() != 200 {
+		return 0, fmt.Errorf("quota request failed with status %d", resp.StatusCode())
+	}
+
+	bits, err = strconv.ParseInt(strings.TrimSpace(resp.String()), 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid quota returned by the external API")
+	}
+
+	return bits, nil
+}
+
+// Allows reports whether the given number of bits can be used without going below MinimumBits, the quota is fetched
+// with ctx when it has expired. When the quota can't be checked the request is allowed, failures are handled by the
+// circuit breaker
+func (q *RandomOrgQuota) Allows(ctx context.Context, bits int64) bool {
+	q.refresh(ctx)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.err != nil || q.checkedAt.IsZero() {
+		return true
+	}
+
+	return q.bits-bits >= q.MinimumBits
+}
+
+// Consume lowers the cached quota until it is fetched again
+func (q *RandomOrgQuota) Consume(bits int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.bits -= bits
+}
+
+// Status returns the cached quota, it is fetched by the requests that use random.org. CheckedAt is zero until then
+func (q *RandomOrgQuota) Status() QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := QuotaStatus{BitsRemaining: q.bits, CheckedAt: q.checkedAt}
+	if q.err != nil {
+		status.Error = q.err.Error()
+	}
+
+	return status
+}
+
+// Exhausted reports whether the cached quota has run out, it is false while the quota can't be checked
+func (q *RandomOrgQuota) Exhausted() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.err == nil && !q.checkedAt.IsZero() && q.bits <= q.MinimumBits
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+const (
+	// MinRandomInteger and MaxRandomInteger are the bounds accepted by random.org
+	MinRandomInteger      = -1_000_000_000
+	MaxRandomInteger      = 1_000_000_000
+	MaxRandomIntegerCount = 10000
+	MaxSequenceLength     = 10000
+)
+
+// RandomNumberService provides the random numbers the other random operations are built from
+type RandomNumberService interface {
+	// GetRandomIntegers returns count integers drawn uniformly between min and max, both inclusive
+	GetRandomIntegers(min, max int64, count int) ([]int64, error)
+	// GetRandomSequence returns a random permutation of the integers from 0 to n-1
+	GetRandomSequence(n int) ([]int, error)
+}
+
+// ValidateIntegerRange checks the range and count against the limits of random.org
+func ValidateIntegerRange(min, max int64, count int) error {
+	if min < MinRandomInteger || max > MaxRandomInteger {
+		return fmt.Errorf("min and max must be between %d and %d", MinRandomInteger, MaxRandomInteger)
+	}
+
+	if min > max {
+		return errors.New("min can't be greater than max")
+	}
+
+	if count < 1 || count > MaxRandomIntegerCount {
+		return fmt.Errorf("count must be between 1 and %d", MaxRandomIntegerCount)
+	}
+
+	return nil
+}
+
+func validateSequenceLength(n int) error {
+	if n < 1 || n > MaxSequenceLength {
+		return fmt.Errorf("the sequence must have between 1 and %d elements", MaxSequenceLength)
+	}
+
+	return nil
+}
+
+// integerBits is the amount of randomness needed for count integers in the range
+func integerBits(min, max int64, count int) int64 {
+	return int64(math.Ceil(math.Log2(float64(max-min+1)))) * int64(count)
+}
+
+// sequenceBits is the amount of randomness needed for a permutation of n elements, log2(n!)
+func sequenceBits(n int) int64 {
+	bits := 0.0
+	for i := 2; i <= n; i++ {
+		bits += math.Log2(float64(i))
+	}
+
+	return int64(math.Ceil(bits))
+}
+
+func (l *LocalRandomStringService) GetRandomIntegers(min, max int64, count int) ([]int64, error) {
+	if err := ValidateIntegerRange(min, max, count); err != nil {
+		return nil, err
+	}
+
+	results := make([]int64, count)
+	for i := range results {
+		n, err := rand.Int(rand.Reader, big.NewInt(max-min+1))
+		if err != nil {
+			return nil, err
+		}
+		results[i] = min + n.Int64()
+	}
+
+	return results, nil
+}
+
+func (l *LocalRandomStringService) GetRandomSequence(n int) ([]int, error) {
+	if err := validateSequenceLength(n); err != nil {
+		return nil, err
+	}
+
+	// Fisher-Yates shuffle
+	sequence := make([]int, n)
+	for i := range sequence {
+		sequence[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		sequence[i], sequence[j.Int64()] = sequence[j.Int64()], sequence[i]
+	}
+
+	return sequence, nil
+}
+
+func (r *RealRandomStringService) GetRandomIntegers(min, max int64, count int) ([]int64, error) {
+	if err := ValidateIntegerRange(min, max, count); err != nil {
+		return nil, err
+	}
+
+	var results []int64
+	err := r.protect(integerBits(min, max, count), func() (err error) {
+		results, err = r.fetchIntegers(min, max, count)
+		return err
+	})
+	if fallback, ok := r.Fallback.(RandomNumberService); ok && IsUnavailable(err) {
+		return fallback.GetRandomIntegers(min, max, count)
+	}
+
+	return results, err
+}
+
+func (r *RealRandomStringService) GetRandomSequence(n int) ([]int, error) {
+	if err := validateSequenceLength(n); err != nil {
+		return nil, err
+	}
+
+	var results []int
+	err := r.protect(sequenceBits(n), func() (err error) {
+		results, err = r.fetchSequence(n)
+		return err
+	})
+	if fallback, ok := r.Fallback.(RandomNumberService); ok && IsUnavailable(err) {
+		return fallback.GetRandomSequence(n)
+	}
+
+	return results, err
+}
+
+// fetchIntegers uses random.org's integers API
+func (r *RealRandomStringService) fetchIntegers(min, max int64, count int) ([]int64, error) {
+	url := fmt.Sprintf("%s/integers/?num=%d&min=%d&max=%d&col=1&base=10&format=plain&rnd=new", r.baseURL(), count, min, max)
+
+	values, err := r.get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != count {
+		return nil, fmt.Errorf("external API returned %d integers instead of %d", len(values), count)
+	}
+
+	results := make([]int64, count)
+	for i, value := range values {
+		integer, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || integer < min || integer > max {
+			return nil, errors.New("external API returned an invalid random integer")
+		}
+		results[i] = integer
+	}
+
+	return results, nil
+}
+
+// fetchSequence uses random.org's sequences API
+func (r *RealRandomStringService) fetchSequence(n int) ([]int, error) {
+	url := fmt.Sprintf("%s/sequences/?min=0&max=%d&col=1&format=plain&rnd=new", r.baseURL(), n-1)
+
+	values, err := r.get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != n {
+		return nil, fmt.Errorf("external API returned a sequence of %d elements instead of %d", len(values), n)
+	}
+
+	// Every integer from 0 to n-1 must appear exactly once
+	seen := make([]bool, n)
+	results := make([]int, n)
+	for i, value := range values {
+		integer, err := strconv.Atoi(value)
+		if err != nil || integer < 0 || integer >= n || seen[integer] {
+			return nil, errors.New("external API returned an invalid random sequence")
+		}
+		seen[integer] = true
+		results[i] = integer
+	}
+
+	return results, nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MaxDecimals  = 9
+	MaxDice      = 100
+	MaxDiceSides = 1000
+)
+
+// RandomDecimals returns count decimal fractions between 0 and 1 with the given number of decimal places
+func RandomDecimals(source RandomNumberService, decimals, count int) ([]string, error) {
+	if decimals < 1 || decimals > MaxDecimals {
+		return nil, fmt.Errorf("decimals must be between 1 and %d", MaxDecimals)
+	}
+
+	max := int64(1)
+	for i := 0; i < decimals; i++ {
+		max *= 10
+	}
+
+	integers, err := source.GetRandomIntegers(0, max-1, count)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]string, len(integers))
+	for i, integer := range integers {
+		results[i] = fmt.Sprintf("0.%0*d", decimals, integer)
+	}
+
+	return results, nil
+}
+
+// randomBytes draws n random bytes from the source
+func randomBytes(source RandomNumberService, n int) ([]byte, error) {
+	integers, err := source.GetRandomIntegers(0, 255, n)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes := make([]byte, n)
+	for i, integer := range integers {
+		bytes[i] = byte(integer)
+	}
+
+	return bytes, nil
+}
+
+// formatUUID sets the version and RFC 4122 variant bits and formats the UUID
+func formatUUID(uuid []byte, version byte) string {
+	uuid[6] = (uuid[6] & 0x0f) | version<<4
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	encoded := hex.EncodeToString(uuid)
+	return encoded[0:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:32]
+}
+
+// UUIDv4 returns a random UUID
+func UUIDv4(source RandomNumberService) (string, error) {
+	uuid, err := randomBytes(source, 16)
+	if err != nil {
+		return "", err
+	}
+
+	return formatUUID(uuid, 4), nil
+}
+
+// UUIDv7 returns a UUID starting with the given time in milliseconds, so UUIDs sort by creation time
+func UUIDv7(source RandomNumberService, now time.Time) (string, error) {
+	random, err := randomBytes(source, 10)
+	if err != nil {
+		return "", err
+	}
+
+	uuid := make([]byte, 16)
+	milliseconds := now.UnixMilli()
+	for i := 0; i < 6; i++ {
+		uuid[i] = byte(milliseconds >> (8 * (5 - i)))
+	}
+	copy(uuid[6:], random)
+
+	return formatUUID(uuid, 7), nil
+}
+
+// Dice is a roll in dice notation, e.g. 3d6+2
+type Dice struct {
+	Count    int
+	Sides    int
+	Modifier int
+}
+
+var diceNotation = regexp.MustCompile(`^(\d*)[dD](\d+)([+-]\d+)?$`)
+
+// ParseDice parses dice notation like 3d6, d20 or 2d8-1
+func ParseDice(notation string) (Dice, error) {
+	matches := diceNotation.FindStringSubmatch(strings.ReplaceAll(notation, " ", ""))
+	if matches == nil {
+		return Dice{}, errors.New("dice must use dice notation, e.g. 3d6 or 2d8+1")
+	}
+
+	dice := Dice{Count: 1}
+	if matches[1] != "" {
+		dice.Count, _ = strconv.Atoi(matches[1])
+	}
+	dice.Sides, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		dice.Modifier, _ = strconv.Atoi(matches[3])
+	}
+
+	if dice.Count < 1 || dice.Count > MaxDice {
+		return Dice{}, fmt.Errorf("the number of dice must be between 1 and %d", MaxDice)
+	}
+	if dice.Sides < 2 || dice.Sides > MaxDiceSides {
+		return Dice{}, fmt.Errorf("dice must have between 2 and %d sides", MaxDiceSides)
+	}
+
+	return dice, nil
+}
+
+// RollDice rolls the dice and returns a result like "4 + 2 + 6 + 2 = 14"
+func RollDice(source RandomNumberService, dice Dice) (string, error) {
+	rolls, err := source.GetRandomIntegers(1, int64(dice.Sides), dice.Count)
+	if err != nil {
+		return "", err
+	}
+
+	total := int64(dice.Modifier)
+	terms := make([]string, len(rolls))
+	for i, roll := range rolls {
+		total += roll
+		terms[i] = strconv.FormatInt(roll, 10)
+	}
+
+	result := strings.Join(terms, " + ")
+	if dice.Modifier > 0 {
+		result += fmt.Sprintf(" + %d", dice.Modifier)
+	} else if dice.Modifier < 0 {
+		result += fmt.Sprintf(" - %d", -dice.Modifier)
+	}
+
+	return fmt.Sprintf("%s = %d", result, total), nil
+}
+
+// Shuffle returns the items in a random order
+func Shuffle(source RandomNumberService, items []string) ([]string, error) {
+	if len(items) == 0 {
+		return nil, errors.New("at least one item is required to shuffle")
+	}
+
+	sequence, err := source.GetRandomSequence(len(items))
+	if err != nil {
+		return nil, err
+	}
+
+	shuffled := make([]string, len(items))
+	for i, index := range sequence {
+		shuffled[i] = items[index]
+	}
+
+	return shuffled, nil
+}
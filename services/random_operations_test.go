@@ -0,0 +1,142 @@
+package services_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// fixedNumberService always returns the same numbers so the results are predictable
+type fixedNumberService struct {
+	integers []int64
+	sequence []int
+}
+
+func (f *fixedNumberService) GetRandomIntegers(min, max int64, count int) ([]int64, error) {
+	return f.integers[:count], nil
+}
+
+func (f *fixedNumberService) GetRandomSequence(n int) ([]int, error) {
+	return f.sequence[:n], nil
+}
+
+// TestParseDice tests the supported dice notations
+func TestParseDice(t *testing.T) {
+	dice, err := services.ParseDice("3d6+2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dice != (services.Dice{Count: 3, Sides: 6, Modifier: 2}) {
+		t.Errorf("unexpected dice %+v", dice)
+	}
+
+	dice, err = services.ParseDice("d20")
+	if err != nil || dice.Count != 1 || dice.Sides != 20 {
+		t.Errorf("expected a single d20, but got %+v, %v", dice, err)
+	}
+
+	for _, notation := range []string{"", "3x6", "0d6", "3d1", "101d6"} {
+		if _, err := services.ParseDice(notation); err == nil {
+			t.Errorf("expected an error for %q, but got nil", notation)
+		}
+	}
+}
+
+// TestRollDice tests the format of a dice roll
+func TestRollDice(t *testing.T) {
+	source := &fixedNumberService{integers: []int64{4, 2, 6}}
+
+	result, err := services.RollDice(source, services.Dice{Count: 3, Sides: 6, Modifier: -1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "4 + 2 + 6 - 1 = 11"
+	if result != expected {
+		t.Errorf("expected %s, but got %s", expected, result)
+	}
+}
+
+// TestRandomDecimals tests that the decimals are zero padded
+func TestRandomDecimals(t *testing.T) {
+	source := &fixedNumberService{integers: []int64{7, 123}}
+
+	results, err := services.RandomDecimals(source, 3, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(results, ",") != "0.007,0.123" {
+		t.Errorf("expected 0.007,0.123, but got %v", results)
+	}
+}
+
+// TestUUIDs tests the version and variant of the generated UUIDs
+func TestUUIDs(t *testing.T) {
+	source := &services.LocalRandomStringService{}
+
+	v4, err := services.UUIDv4(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(v4) {
+		t.Errorf("invalid UUID v4 %s", v4)
+	}
+
+	now := time.UnixMilli(0x0123456789ab)
+	v7, err := services.UUIDv7(source, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !regexp.MustCompile(`^01234567-89ab-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(v7) {
+		t.Errorf("invalid UUID v7 %s", v7)
+	}
+}
+
+// TestShuffle tests that the items follow the random sequence
+func TestShuffle(t *testing.T) {
+	source := &fixedNumberService{sequence: []int{2, 0, 1}}
+
+	shuffled, err := services.Shuffle(source, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(shuffled, "") != "cab" {
+		t.Errorf("expected cab, but got %v", shuffled)
+	}
+}
+
+// TestLocalRandomIntegers tests the range of the local random integers and sequences
+func TestLocalRandomIntegers(t *testing.T) {
+	source := &services.LocalRandomStringService{}
+
+	integers, err := source.GetRandomIntegers(-2, 2, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, integer := range integers {
+		if integer < -2 || integer > 2 {
+			t.Errorf("integer %d is out of range", integer)
+		}
+	}
+
+	sequence, err := source.GetRandomSequence(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	seen := map[int]bool{}
+	for _, value := range sequence {
+		seen[value] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("expected a permutation of 10 elements, but got %v", sequence)
+	}
+
+	if _, err := source.GetRandomIntegers(5, 1, 1); err == nil {
+		t.Errorf("expected an error when min is greater than max, but got nil")
+	}
+}
@@ -1,30 +1,405 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+const DefaultRandomOrgURL = "https://www.random.org"
+
+var ErrCircuitOpen = errors.New("random.org is unavailable, please try again later")
+
 type RandomStringService interface {
 	GetRandomString(length int) (string, error)
+	GetRandomStrings(options RandomStringOptions) ([]string, error)
+}
+
+// ProviderStatus describes the health of a random string provider
+type ProviderStatus struct {
+	Provider string       `json:"provider"`
+	Status   string       `json:"status"` // ok, fallback or unavailable
+	Quota    *QuotaStatus `json:"quota,omitempty"`
+}
+
+// StatusReporter is implemented by the providers that can report their health
+type StatusReporter interface {
+	Status() ProviderStatus
+}
+
+// RandomOrgOptions configures the client used to call random.org
+type RandomOrgOptions struct {
+	BaseURL          string
+	Timeout          time.Duration
+	RetryCount       int
+	RetryWaitTime    time.Duration // the wait time grows exponentially between retries, up to RetryMaxWaitTime
+	RetryMaxWaitTime time.Duration
+	BreakerThreshold int // consecutive failures before the circuit breaker opens
+	BreakerCooldown  time.Duration
+	QuotaTTL         time.Duration       // how long the random.org quota is cached, zero disables the quota check
+	QuotaMinimumBits int64               // requests that would leave fewer bits in the quota are refused
+	Fallback         RandomStringService // optional, serves the requests while random.org can't be used
+	Observer         RandomOrgObserver   // optional, told about every call to random.org
+}
+
+// RandomOrgObserver is told about every call to random.org, e.g. to export its latency and errors as metrics.
+// The endpoint is the first segment of the path: strings, integers, sequences or quota
+type RandomOrgObserver interface {
+	ObserveRandomOrgCall(endpoint string, duration time.Duration, err error)
+}
+
+func DefaultRandomOrgOptions() RandomOrgOptions {
+	return RandomOrgOptions{
+		BaseURL:          DefaultRandomOrgURL,
+		Timeout:          5 * time.Second,
+		RetryCount:       2,
+		RetryWaitTime:    200 * time.Millisecond,
+		RetryMaxWaitTime: 2 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		QuotaTTL:         time.Minute,
+	}
 }
 
 type RealRandomStringService struct {
-	Client *resty.Client
+	Client   *resty.Client
+	BaseURL  string              // defaults to DefaultRandomOrgURL
+	Breaker  *CircuitBreaker     // optional
+	Quota    *RandomOrgQuota     // optional
+	Fallback RandomStringService // optional, used while the breaker is open or the quota is exhausted
+	Observer RandomOrgObserver   // optional
+
+	ctx context.Context // set by WithContext, the requests to random.org carry it
 }
 
-func (r *RealRandomStringService) GetRandomString(length int) (string, error) {
-	url := fmt.Sprintf("https://www.random.org/strings/?num=1&len=%d&digits=on&upperalpha=on&loweralpha=on&unique=on&format=plain&rnd=new", length)
+// NewRealRandomStringService creates a random.org client with timeouts, retries with backoff, a circuit breaker
+// and a quota check. Every attempt is traced, and the trace context is sent to random.org in the traceparent header
+func NewRealRandomStringService(options RandomOrgOptions) *RealRandomStringService {
+	client := resty.New().
+		SetTimeout(options.Timeout).
+		SetRetryCount(options.RetryCount).
+		SetRetryWaitTime(options.RetryWaitTime).
+		SetRetryMaxWaitTime(options.RetryMaxWaitTime).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			// Network errors are always retried by resty, server errors and rate limiting are worth retrying too
+			return resp != nil && (resp.StatusCode() >= http.StatusInternalServerError || resp.StatusCode() == http.StatusTooManyRequests)
+		})
+	client.SetTransport(otelhttp.NewTransport(client.GetClient().Transport,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " random.org" + r.URL.Path
+		})))
+
+	service := &RealRandomStringService{
+		Client:   client,
+		BaseURL:  options.BaseURL,
+		Breaker:  NewCircuitBreaker(options.BreakerThreshold, options.BreakerCooldown),
+		Fallback: options.Fallback,
+		Observer: options.Observer,
+	}
+
+	if options.QuotaTTL > 0 {
+		service.Quota = &RandomOrgQuota{
+			Client:      client,
+			BaseURL:     options.BaseURL,
+			TTL:         options.QuotaTTL,
+			MinimumBits: options.QuotaMinimumBits,
+			Observer:    options.Observer,
+		}
+	}
+
+	return service
+}
+
+// WithContext returns a copy of the service whose requests to random.org run with ctx, so they are canceled and traced
+// with the request that needs them. The copy shares the client, the circuit breaker and the quota
+func (r *RealRandomStringService) WithContext(ctx context.Context) *RealRandomStringService {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+// context returns the context bound by WithContext, or the background context
+func (r *RealRandomStringService) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext binds ctx to the requests of the providers that call random.org, see
+// RealRandomStringService.WithContext. Providers that don't make requests are returned as they are
+func WithContext[S any](provider S, ctx context.Context) S {
+	var bound any
+	switch p := any(provider).(type) {
+	case *RealRandomStringService:
+		bound = p.WithContext(ctx)
+	case *RandomStringPool:
+		bound = p.WithContext(ctx)
+	default:
+		return provider
+	}
+
+	if s, ok := bound.(S); ok {
+		return s
+	}
+	return provider
+}
 
-	resp, err := r.Client.R().Get(url)
+func (r *RealRandomStringService) GetRandomString(length int) (string, error) {
+	results, err := r.GetRandomStrings(DefaultRandomStringOptions(length))
 	if err != nil {
 		return "", err
 	}
 
+	return results[0], nil
+}
+
+func (r *RealRandomStringService) GetRandomStrings(options RandomStringOptions) ([]string, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	var results []string
+	err := r.protect(options.Bits(), func() (err error) {
+		if options.Alphabet == "" {
+			results, err = r.fetchRandomStrings(options)
+		} else {
+			results, err = r.fetchCustomAlphabetStrings(options)
+		}
+		return err
+	})
+	if IsUnavailable(err) && r.Fallback != nil {
+		slog.Debug("random.org is unavailable, using the fallback", "error", err)
+		return r.Fallback.GetRandomStrings(options)
+	}
+
+	return results, err
+}
+
+// IsUnavailable reports whether the error means random.org can't be used right now
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrQuotaExhausted) || errors.Is(err, ErrCircuitOpen)
+}
+
+// protect calls random.org through fetch unless the quota is exhausted or the circuit breaker is open
+func (r *RealRandomStringService) protect(bits int64, fetch func() error) error {
+	// Check the quota first so a refused request doesn't use the breaker's half-open trial
+	if r.Quota != nil && !r.Quota.Allows(r.context(), bits) {
+		return ErrQuotaExhausted
+	}
+
+	if r.Breaker != nil && !r.Breaker.Allow() {
+		return ErrCircuitOpen
+	}
+	wasOpen := r.Breaker != nil && r.Breaker.IsOpen()
+
+	err := fetch()
+	if err == nil && r.Quota != nil {
+		r.Quota.Consume(bits)
+	}
+	if r.Breaker != nil {
+		// Requests rejected by random.org because of their parameters don't mean the service is down
+		var clientErr *randomOrgClientError
+		if err == nil || errors.As(err, &clientErr) {
+			r.Breaker.Success()
+		} else if r.canceled(err) {
+			r.Breaker.Abandoned()
+		} else {
+			r.Breaker.Failure()
+			if !wasOpen && r.Breaker.IsOpen() {
+				slog.Warn("random.org keeps failing, the circuit breaker is open", "error", err, "cooldown", r.Breaker.Cooldown.String())
+			}
+		}
+	}
+
+	return err
+}
+
+// canceled reports whether the request failed because the context of the caller was canceled or its deadline passed,
+// the timeouts of the client are failures of random.org
+func (r *RealRandomStringService) canceled(err error) bool {
+	return r.context().Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+}
+
+// Status is unavailable while the breaker is open or the quota is exhausted, and fallback instead when there is a
+// fallback. A fallback is also reported when the quota can't be fetched, random.org is most likely unreachable then
+func (r *RealRandomStringService) Status() ProviderStatus {
+	status := ProviderStatus{Provider: "random.org", Status: "ok"}
+
+	unavailable := r.Breaker != nil && r.Breaker.IsOpen()
+	if r.Quota != nil {
+		// The quota isn't shown until a request has fetched it
+		if quota := r.Quota.Status(); !quota.CheckedAt.IsZero() {
+			status.Quota = &quota
+			unavailable = unavailable || (quota.Error != "" && r.Fallback != nil)
+		}
+		unavailable = unavailable || r.Quota.Exhausted()
+	}
+
+	if unavailable {
+		status.Status = "unavailable"
+		if r.Fallback != nil {
+			status.Status = "fallback"
+		}
+	}
+
+	return status
+}
+
+// randomOrgClientError is returned when random.org rejects the request itself
+type randomOrgClientError struct {
+	message string
+}
+
+func (e *randomOrgClientError) Error() string {
+	return e.message
+}
+
+func (r *RealRandomStringService) baseURL() string {
+	if r.BaseURL == "" {
+		return DefaultRandomOrgURL
+	}
+
+	return strings.TrimSuffix(r.BaseURL, "/")
+}
+
+// get calls random.org and returns the whitespace separated values of a plain format response
+func (r *RealRandomStringService) get(url string) (results []string, err error) {
+	if r.Observer != nil {
+		start := time.Now()
+		defer func() {
+			r.Observer.ObserveRandomOrgCall(randomOrgEndpoint(r.baseURL(), url), time.Since(start), err)
+		}()
+	}
+
+	resp, err := r.Client.R().SetContext(r.context()).Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() >= 400 && resp.StatusCode() < 500 && resp.StatusCode() != http.StatusTooManyRequests {
+		return nil, &randomOrgClientError{message: "random string request was rejected by the external API: " + strings.TrimSpace(resp.String())}
+	}
+
 	if resp.StatusCode() != 200 {
-		return "", errors.New("failed to fetch random string from external API")
+		return nil, errors.New("failed to fetch random string from external API")
+	}
+
+	// random.org answers with one value per line
+	return strings.Fields(resp.String()), nil
+}
+
+// randomOrgEndpoint returns the first segment of the path of a random.org URL, e.g. strings
+func randomOrgEndpoint(baseURL, url string) string {
+	path := strings.TrimPrefix(strings.TrimPrefix(url, baseURL), "/")
+	endpoint, _, _ := strings.Cut(path, "/")
+	endpoint, _, _ = strings.Cut(endpoint, "?")
+	return endpoint
+}
+
+// fetchRandomStrings uses random.org's strings API, which supports the digits, upper and lower alpha character sets
+func (r *RealRandomStringService) fetchRandomStrings(options RandomStringOptions) ([]string, error) {
+	url := fmt.Sprintf("%s/strings/?num=%d&len=%d&digits=%s&upperalpha=%s&loweralpha=%s&unique=%s&format=plain&rnd=new",
+		r.baseURL(), options.Count, options.Length,
+		onOff(options.Digits), onOff(options.UpperAlpha), onOff(options.LowerAlpha), onOff(options.Unique))
+
+	results, err := r.get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateStrings(results, options); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// fetchCustomAlphabetStrings builds the strings from random.org integers used as indexes in the custom alphabet,
+// since the strings API doesn't support custom alphabets
+func (r *RealRandomStringService) fetchCustomAlphabetStrings(options RandomStringOptions) ([]string, error) {
+	characters := options.Characters()
+
+	var indexes []int
+	nextIndex := func() (int, error) {
+		if len(indexes) == 0 {
+			// Fetch the indexes for all the missing strings at once, random.org allows up to 10000 per request
+			num := options.Length * options.Count
+			if num > MaxRandomIntegerCount {
+				num = MaxRandomIntegerCount
+			}
+			values, err := r.fetchIntegers(0, int64(len(characters)-1), num)
+			if err != nil {
+				return 0, err
+			}
+			for _, value := range values {
+				indexes = append(indexes, int(value))
+			}
+		}
+
+		index := indexes[0]
+		indexes = indexes[1:]
+		return index, nil
+	}
+
+	results, err := generateStrings(options, func() (string, error) {
+		result := make([]rune, options.Length)
+		for i := range result {
+			index, err := nextIndex()
+			if err != nil {
+				return "", err
+			}
+			result[i] = characters[index]
+		}
+		return string(result), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// validateStrings checks that random.org returned what was asked for
+func validateStrings(results []string, options RandomStringOptions) error {
+	if len(results) != options.Count {
+		return fmt.Errorf("external API returned %d strings instead of %d", len(results), options.Count)
+	}
+
+	characters := map[rune]bool{}
+	for _, char := range options.Characters() {
+		characters[char] = true
+	}
+
+	for _, result := range results {
+		if utf8.RuneCountInString(result) != options.Length {
+			return fmt.Errorf("external API returned a string of length %d instead of %d", utf8.RuneCountInString(result), options.Length)
+		}
+		for _, char := range result {
+			if !characters[char] {
+				return errors.New("external API returned an invalid random string")
+			}
+		}
+	}
+
+	if options.Unique && !uniqueStrings(results) {
+		return errors.New("external API returned repeated strings")
+	}
+
+	return nil
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
 	}
 
-	return resp.String(), nil
+	return "off"
 }
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	digits     = "0123456789"
+	upperAlpha = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	lowerAlpha = "abcdefghijklmnopqrstuvwxyz"
+
+	// MinRandomStringLength and MaxRandomStringLength are the lengths accepted by random.org
+	MinRandomStringLength = 1
+	MaxRandomStringLength = 20
+	MaxRandomStringCount  = 10000
+)
+
+// RandomStringOptions describes the random strings to generate
+type RandomStringOptions struct {
+	Length     int
+	Count      int
+	Digits     bool
+	UpperAlpha bool
+	LowerAlpha bool
+	Alphabet   string // custom alphabet, replaces the character classes when set
+	Unique     bool   // no string is repeated within the request
+}
+
+// DefaultRandomStringOptions asks for a single string of digits, upper and lower alpha like random.org's defaults
+func DefaultRandomStringOptions(length int) RandomStringOptions {
+	return RandomStringOptions{
+		Length:     length,
+		Count:      1,
+		Digits:     true,
+		UpperAlpha: true,
+		LowerAlpha: true,
+		Unique:     true,
+	}
+}
+
+// IsDefaultCharset reports whether the strings use the default digits, upper and lower alpha characters
+func (o RandomStringOptions) IsDefaultCharset() bool {
+	return o.Alphabet == "" && o.Digits && o.UpperAlpha && o.LowerAlpha
+}
+
+// Characters returns the characters the strings are made of, without duplicates
+func (o RandomStringOptions) Characters() []rune {
+	if o.Alphabet != "" {
+		characters := []rune{}
+		seen := map[rune]bool{}
+		for _, char := range o.Alphabet {
+			if !seen[char] {
+				seen[char] = true
+				characters = append(characters, char)
+			}
+		}
+		return characters
+	}
+
+	var alphabet string
+	if o.Digits {
+		alphabet += digits
+	}
+	if o.UpperAlpha {
+		alphabet += upperAlpha
+	}
+	if o.LowerAlpha {
+		alphabet += lowerAlpha
+	}
+
+	return []rune(alphabet)
+}
+
+// Validate checks the options against the limits of random.org
+func (o RandomStringOptions) Validate() error {
+	if o.Length < MinRandomStringLength || o.Length > MaxRandomStringLength {
+		return fmt.Errorf("length must be between %d and %d", MinRandomStringLength, MaxRandomStringLength)
+	}
+
+	if o.Count < 1 || o.Count > MaxRandomStringCount {
+		return fmt.Errorf("count must be between 1 and %d", MaxRandomStringCount)
+	}
+
+	if strings.IndexFunc(o.Alphabet, unicode.IsSpace) >= 0 {
+		return errors.New("alphabet can't contain whitespace")
+	}
+
+	characters := len(o.Characters())
+	if characters == 0 {
+		return errors.New("at least one character set or a custom alphabet is required")
+	}
+
+	// Enough different strings must exist to return count unique ones
+	if o.Unique && math.Pow(float64(characters), float64(o.Length)) < float64(o.Count) {
+		return errors.New("there aren't enough different strings for the requested count with unique strings")
+	}
+
+	return nil
+}
+
+// Bits is the amount of randomness needed for the strings
+func (o RandomStringOptions) Bits() int64 {
+	return requiredBits(o.Length, len(o.Characters())) * int64(o.Count)
+}
+
+// RandomStringCost scales the base cost of the operation, which pays for a default string of length 10,
+// with the amount of randomness requested. It is rounded up to cents
+func RandomStringCost(baseCost float64, options RandomStringOptions) float64 {
+	referenceBits := DefaultRandomStringOptions(10).Bits()
+	cost := baseCost * float64(options.Bits()) / float64(referenceBits)
+
+	// The small epsilon keeps float errors like 2.5000000001 from being rounded up to the next cent
+	return math.Ceil(cost*100-1e-9) / 100
+}
+
+// uniqueStrings reports whether no string is repeated
+func uniqueStrings(values []string) bool {
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// TestRandomStringOptionsValidate tests the limits of the random string options
+func TestRandomStringOptionsValidate(t *testing.T) {
+	valid := services.DefaultRandomStringOptions(20)
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tooLong := services.DefaultRandomStringOptions(21)
+	if err := tooLong.Validate(); err == nil {
+		t.Errorf("expected an error for length 21, but got nil")
+	}
+
+	noCharset := services.RandomStringOptions{Length: 5, Count: 1}
+	if err := noCharset.Validate(); err == nil {
+		t.Errorf("expected an error without character sets, but got nil")
+	}
+
+	notEnoughCombinations := services.RandomStringOptions{Length: 1, Count: 3, Alphabet: "ab", Unique: true}
+	if err := notEnoughCombinations.Validate(); err == nil {
+		t.Errorf("expected an error when there aren't enough unique strings, but got nil")
+	}
+}
+
+// TestRandomStringCost tests that the cost scales with the amount of randomness
+func TestRandomStringCost(t *testing.T) {
+	defaultOptions := services.DefaultRandomStringOptions(10)
+	if cost := services.RandomStringCost(2.5, defaultOptions); cost != 2.5 {
+		t.Errorf("expected the base cost for the default string, but got %v", cost)
+	}
+
+	batch := services.DefaultRandomStringOptions(20)
+	batch.Count = 3
+	if cost := services.RandomStringCost(2.5, batch); cost != 15 {
+		t.Errorf("expected a cost of 15 for 3 strings of length 20, but got %v", cost)
+	}
+
+	digitsOnly := services.RandomStringOptions{Length: 10, Count: 1, Digits: true}
+	if cost := services.RandomStringCost(2.5, digitsOnly); cost >= 2.5 {
+		t.Errorf("expected digits only to be cheaper than the default string, but got %v", cost)
+	}
+}
+
+// TestLocalRandomStringCustomAlphabet tests unique strings from a custom alphabet
+func TestLocalRandomStringCustomAlphabet(t *testing.T) {
+	service := &services.LocalRandomStringService{}
+
+	// There are exactly 4 different strings, so all of them must be returned
+	results, err := service.GetRandomStrings(services.RandomStringOptions{Length: 2, Count: 4, Alphabet: "xy", Unique: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, result := range results {
+		if len(result) != 2 || result[0] != 'x' && result[0] != 'y' || seen[result] {
+			t.Errorf("unexpected strings %v", results)
+		}
+		seen[result] = true
+	}
+}
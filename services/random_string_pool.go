@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+)
+
+// RandomStringPool serves single random strings of common lengths with the default character sets from batches
+// fetched in the background, so users don't wait on a round trip to random.org.
+// Any other request, or an empty pool, goes straight to the source.
+// A string is removed from the pool when it is handed out, and the last Remember strings handed out of every length are
+// kept out of the refills, so the pool doesn't serve a string twice while it is remembered
+type RandomStringPool struct {
+	Source       RandomStringService
+	Lengths      []int // lengths kept in the pool
+	BatchSize    int   // strings fetched in every call to the source
+	LowWaterMark int   // a length is refilled when it has fewer strings than this
+	Remember     int   // handed out strings of every length that a refill can't bring back
+
+	mu      sync.Mutex
+	strings map[int][]string
+	served  map[int]*recentStrings
+	refill  chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewRandomStringPool(source RandomStringService, lengths []int, batchSize, lowWaterMark int) *RandomStringPool {
+	return &RandomStringPool{
+		Source:       source,
+		Lengths:      lengths,
+		BatchSize:    batchSize,
+		LowWaterMark: lowWaterMark,
+		Remember:     10 * batchSize,
+	}
+}
+
+// Start fills the pool and keeps refilling it in the background until Stop is called
+func (p *RandomStringPool) Start() {
+	p.mu.Lock()
+	p.strings = make(map[int][]string, len(p.Lengths))
+	p.served = make(map[int]*recentStrings, len(p.Lengths))
+	for _, length := range p.Lengths {
+		p.strings[length] = []string{}
+		p.served[length] = newRecentStrings(p.Remember)
+	}
+	p.refill = make(chan struct{}, 1)
+	p.stop = make(chan struct{})
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		p.fill()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-p.refill:
+				p.fill()
+			}
+		}
+	}()
+}
+
+// Stop stops the background refills and waits for the one in progress to finish
+func (p *RandomStringPool) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+// fill fetches a batch for every length below the low-water mark
+func (p *RandomStringPool) fill() {
+	for _, length := range p.Lengths {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		if p.Size(length) >= p.LowWaterMark {
+			continue
+		}
+
+		options := DefaultRandomStringOptions(length)
+		options.Count = p.BatchSize
+		// A batch of unique strings can't be larger than the number of different strings
+		if possible := math.Pow(float64(len(options.Characters())), float64(length)); possible < float64(options.Count) {
+			options.Count = int(possible)
+		}
+		batch, err := p.Source.GetRandomStrings(options)
+		if err != nil {
+			slog.Warn("failed to refill the random string pool", "length", length, "error", err)
+			continue
+		}
+
+		p.mu.Lock()
+		// Batches are unique on their own, but two batches could share a string, with each other or with the strings
+		// already handed out
+		existing := make(map[string]bool, len(p.strings[length]))
+		for _, s := range p.strings[length] {
+			existing[s] = true
+		}
+		for _, s := range batch {
+			if !existing[s] && !p.served[length].contains(s) {
+				existing[s] = true
+				p.strings[length] = append(p.strings[length], s)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Size returns the number of strings of the given length in the pool
+func (p *RandomStringPool) Size(length int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.strings[length])
+}
+
+func (p *RandomStringPool) GetRandomString(length int) (string, error) {
+	results, err := p.GetRandomStrings(DefaultRandomStringOptions(length))
+	if err != nil {
+		return "", err
+	}
+
+	return results[0], nil
+}
+
+func (p *RandomStringPool) GetRandomStrings(options RandomStringOptions) ([]string, error) {
+	return p.getRandomStrings(p.Source, options)
+}
+
+// WithContext returns the pool with its source bound to ctx, see RealRandomStringService.WithContext.
+// The background refills keep running without it
+func (p *RandomStringPool) WithContext(ctx context.Context) RandomStringService {
+	return &boundPool{pool: p, source: WithContext(p.Source, ctx)}
+}
+
+// getRandomStrings serves the request from the pool when it can, or from the source
+func (p *RandomStringPool) getRandomStrings(source RandomStringService, options RandomStringOptions) ([]string, error) {
+	if options.Count != 1 || !options.IsDefaultCharset() {
+		return source.GetRandomStrings(options)
+	}
+
+	p.mu.Lock()
+	pooled, ok := p.strings[options.Length]
+	if !ok || len(pooled) == 0 {
+		p.mu.Unlock()
+		if ok {
+			p.requestRefill()
+		}
+		return source.GetRandomStrings(options)
+	}
+
+	result := pooled[len(pooled)-1]
+	p.strings[options.Length] = pooled[:len(pooled)-1]
+	p.served[options.Length].add(result)
+	low := len(p.strings[options.Length]) < p.LowWaterMark
+	p.mu.Unlock()
+
+	if low {
+		p.requestRefill()
+	}
+
+	return []string{result}, nil
+}
+
+// requestRefill wakes up the background worker without blocking, a pending request is enough
+func (p *RandomStringPool) requestRefill() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+func (p *RandomStringPool) Status() ProviderStatus {
+	if reporter, ok := p.Source.(StatusReporter); ok {
+		return reporter.Status()
+	}
+
+	return ProviderStatus{Provider: "pool", Status: "ok"}
+}
+
+// boundPool is a pool whose requests that miss it go to a source bound to a context
+type boundPool struct {
+	pool   *RandomStringPool
+	source RandomStringService
+}
+
+func (b *boundPool) GetRandomString(length int) (string, error) {
+	results, err := b.GetRandomStrings(DefaultRandomStringOptions(length))
+	if err != nil {
+		return "", err
+	}
+
+	return results[0], nil
+}
+
+func (b *boundPool) GetRandomStrings(options RandomStringOptions) ([]string, error) {
+	return b.pool.getRandomStrings(b.source, options)
+}
+
+func (b *boundPool) Status() ProviderStatus {
+	return b.pool.Status()
+}
+
+// recentStrings remembers the last strings added to it, up to its capacity
+type recentStrings struct {
+	set   map[string]bool
+	order []string
+	next  int
+}
+
+func newRecentStrings(capacity int) *recentStrings {
+	return &recentStrings{set: make(map[string]bool, capacity), order: make([]string, 0, capacity)}
+}
+
+func (r *recentStrings) add(s string) {
+	if cap(r.order) == 0 {
+		return
+	}
+
+	if len(r.order) < cap(r.order) {
+		r.order = append(r.order, s)
+	} else {
+		delete(r.set, r.order[r.next])
+		r.order[r.next] = s
+		r.next = (r.next + 1) % len(r.order)
+	}
+	r.set[s] = true
+}
+
+func (r *recentStrings) contains(s string) bool {
+	return r.set[s]
+}
@@ -0,0 +1,188 @@
+package services_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// sequentialBatchService returns unique strings from a counter so duplicates are easy to spot
+type sequentialBatchService struct {
+	counter    int64
+	batchCalls int64
+}
+
+func (s *sequentialBatchService) GetRandomString(length int) (string, error) {
+	return fmt.Sprintf("direct-%d", atomic.AddInt64(&s.counter, 1)), nil
+}
+
+func (s *sequentialBatchService) GetRandomStrings(options services.RandomStringOptions) ([]string, error) {
+	if options.Count == 1 {
+		result, err := s.GetRandomString(options.Length)
+		return []string{result}, err
+	}
+
+	atomic.AddInt64(&s.batchCalls, 1)
+	results := make([]string, options.Count)
+	for i := range results {
+		results[i] = fmt.Sprintf("pooled-%d", atomic.AddInt64(&s.counter, 1))
+	}
+	return results, nil
+}
+
+// waitForPool waits until the pool has at least the given number of strings of the given length
+func waitForPool(t *testing.T, pool *services.RandomStringPool, length, size int) {
+	deadline := time.Now().Add(time.Second)
+	for pool.Size(length) < size {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the pool to have %d strings of length %d, but it has %d", size, length, pool.Size(length))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestRandomStringPoolNeverRepeats tests that concurrent requests never get the same string
+func TestRandomStringPoolNeverRepeats(t *testing.T) {
+	source := &sequentialBatchService{}
+	pool := services.NewRandomStringPool(source, []int{10}, 20, 5)
+	pool.Start()
+	defer pool.Stop()
+
+	waitForPool(t, pool, 10, 20)
+
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := pool.GetRandomString(10)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[result] {
+				t.Errorf("string %s was handed out twice", result)
+			}
+			seen[result] = true
+		}()
+	}
+	wg.Wait()
+
+	// The pool is refilled in the background
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&source.batchCalls) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the pool to be refilled below the low-water mark")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestRandomStringPoolOtherLengths tests that lengths outside the pool go straight to the source
+func TestRandomStringPoolOtherLengths(t *testing.T) {
+	source := &sequentialBatchService{}
+	pool := services.NewRandomStringPool(source, []int{10}, 5, 1)
+	pool.Start()
+	defer pool.Stop()
+
+	result, err := pool.GetRandomString(7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result[:7] != "direct-" {
+		t.Errorf("expected a string from the source, but got %s", result)
+	}
+}
+
+// fixedBatchService returns the same batch every time and records the options of the batches
+type fixedBatchService struct {
+	mu      sync.Mutex
+	batch   []string
+	options []services.RandomStringOptions
+}
+
+func (s *fixedBatchService) GetRandomString(length int) (string, error) {
+	return "direct", nil
+}
+
+func (s *fixedBatchService) GetRandomStrings(options services.RandomStringOptions) ([]string, error) {
+	if options.Count == 1 {
+		return []string{"direct"}, nil
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.options = append(s.options, options)
+	return s.batch, nil
+}
+
+// TestRandomStringPoolRefillSkipsHandedOut tests that a refill doesn't bring back the strings already handed out
+func TestRandomStringPoolRefillSkipsHandedOut(t *testing.T) {
+	source := &fixedBatchService{batch: []string{"a", "b", "c"}}
+	pool := services.NewRandomStringPool(source, []int{10}, 3, 3)
+	pool.Start()
+
+	waitForPool(t, pool, 10, 3)
+
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		result, _ := pool.GetRandomString(10)
+		if seen[result] {
+			t.Errorf("string %s was handed out twice", result)
+		}
+		seen[result] = true
+	}
+
+	// Wait for the refill that the empty pool asked for
+	deadline := time.Now().Add(time.Second)
+	for {
+		source.mu.Lock()
+		refills := len(source.options)
+		source.mu.Unlock()
+		if refills >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the pool to be refilled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Stopping waits for the refill to finish
+	pool.Stop()
+
+	if size := pool.Size(10); size != 0 {
+		t.Errorf("expected the refill to skip the strings handed out, got %d strings", size)
+	}
+	if result, _ := pool.GetRandomString(10); result != "direct" {
+		t.Errorf("expected the request to go to the source, got %s", result)
+	}
+}
+
+// TestRandomStringPoolShortLength tests that the batches of a length with few different strings are capped to them
+func TestRandomStringPoolShortLength(t *testing.T) {
+	source := &fixedBatchService{batch: []string{"a"}}
+	pool := services.NewRandomStringPool(source, []int{1}, 100, 20)
+	pool.Start()
+	defer pool.Stop()
+
+	waitForPool(t, pool, 1, 1)
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.options[0].Count != 62 {
+		t.Errorf("expected a batch of the 62 strings of length 1, got %d", source.options[0].Count)
+	}
+}
@@ -0,0 +1,365 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// newTestRandomOrgService creates a client for the given stand-in server, without waiting between retries
+// and without checking the quota
+func newTestRandomOrgService(server *httptest.Server) *services.RealRandomStringService {
+	options := services.DefaultRandomOrgOptions()
+	options.BaseURL = server.URL
+	options.Timeout = time.Second
+	options.RetryWaitTime = time.Millisecond
+	options.RetryMaxWaitTime = time.Millisecond
+	options.BreakerThreshold = 2
+	options.QuotaTTL = 0
+
+	return services.NewRealRandomStringService(options)
+}
+
+// TestRealRandomStringTrimsResponse tests that the trailing newline sent by random.org is removed
+func TestRealRandomStringTrimsResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("len") != "5" {
+			t.Errorf("expected length 5 in the request, but got %s", r.URL.Query().Get("len"))
+		}
+		w.Write([]byte("aB3dE\n"))
+	}))
+	defer server.Close()
+
+	result, err := newTestRandomOrgService(server).GetRandomString(5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result != "aB3dE" {
+		t.Errorf("expected aB3dE, but got %q", result)
+	}
+}
+
+// TestRealRandomStringRetries tests that server errors are retried
+func TestRealRandomStringRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("abc\n"))
+	}))
+	defer server.Close()
+
+	result, err := newTestRandomOrgService(server).GetRandomString(3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result != "abc" || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected abc after 2 calls, but got %q after %d calls", result, calls)
+	}
+}
+
+// TestRealRandomStringValidatesResponse tests that a response of the wrong length is rejected
+func TestRealRandomStringValidatesResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Error: something went wrong\n"))
+	}))
+	defer server.Close()
+
+	if _, err := newTestRandomOrgService(server).GetRandomString(5); err == nil {
+		t.Errorf("expected an error for an invalid response, but got nil")
+	}
+}
+
+// TestRealRandomStringCircuitBreaker tests that the breaker opens after repeated failures and uses the fallback
+func TestRealRandomStringCircuitBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	service := newTestRandomOrgService(server)
+	for i := 0; i < 2; i++ {
+		if _, err := service.GetRandomString(5); err == nil {
+			t.Fatalf("expected an error from the failing server, but got nil")
+		}
+	}
+	callsBeforeOpen := atomic.LoadInt32(&calls)
+
+	if _, err := service.GetRandomString(5); !errors.Is(err, services.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, but got %v", err)
+	}
+
+	service.Fallback = &services.LocalRandomStringService{}
+	result, err := service.GetRandomString(5)
+	if err != nil || len(result) != 5 {
+		t.Errorf("expected a fallback string of length 5, but got %q, %v", result, err)
+	}
+
+	if atomic.LoadInt32(&calls) != callsBeforeOpen {
+		t.Errorf("expected no calls to the server while the breaker is open")
+	}
+}
+
+// TestRealRandomStringCanceled tests that requests given up by their callers aren't counted as failures of random.org,
+// unlike the timeouts of the client
+func TestRealRandomStringCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	service := newTestRandomOrgService(server)
+	service.Client.SetRetryCount(0)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := service.WithContext(ctx).GetRandomString(5)
+		cancel()
+		if err == nil || errors.Is(err, services.ErrCircuitOpen) {
+			t.Fatalf("expected the canceled request to reach the server, but got %v", err)
+		}
+	}
+	if service.Breaker.IsOpen() {
+		t.Fatalf("expected the canceled requests not to open the breaker")
+	}
+
+	service.Client.SetTimeout(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		service.GetRandomString(5)
+	}
+	if !service.Breaker.IsOpen() {
+		t.Errorf("expected the timeouts of the client to open the breaker")
+	}
+}
+
+// TestCircuitBreakerHalfOpen tests that a single trial call is allowed after the cooldown
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	breaker := services.NewCircuitBreaker(1, time.Minute)
+	breaker.Now = func() time.Time { return now }
+
+	breaker.Failure()
+	if breaker.Allow() {
+		t.Fatalf("expected the breaker to be open")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.Allow() {
+		t.Fatalf("expected a trial call after the cooldown")
+	}
+	if breaker.Allow() {
+		t.Errorf("expected a single trial call while half-open")
+	}
+
+	breaker.Success()
+	if breaker.IsOpen() || !breaker.Allow() {
+		t.Errorf("expected the breaker to close after a successful trial")
+	}
+}
+
+// TestRealRandomStringQuota tests that requests are refused before the quota runs out and that the quota is cached
+func TestRealRandomStringQuota(t *testing.T) {
+	var quotaCalls, stringCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/quota/" {
+			atomic.AddInt32(&quotaCalls, 1)
+			w.Write([]byte("100\n"))
+			return
+		}
+		atomic.AddInt32(&stringCalls, 1)
+		w.Write([]byte("abcdefghij\n"))
+	}))
+	defer server.Close()
+
+	service := newTestRandomOrgService(server)
+	service.Quota = &services.RandomOrgQuota{Client: service.Client, BaseURL: server.URL, TTL: time.Minute}
+
+	// 10 characters out of 62 need 60 bits, so only the first request fits in the quota
+	if _, err := service.GetRandomString(10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.GetRandomString(10); !errors.Is(err, services.ErrQuotaExhausted) {
+		t.Errorf("expected ErrQuotaExhausted, but got %v", err)
+	}
+
+	service.Fallback = &services.LocalRandomStringService{}
+	if result, err := service.GetRandomString(10); err != nil || len(result) != 10 {
+		t.Errorf("expected a fallback string of length 10, but got %q, %v", result, err)
+	}
+
+	if atomic.LoadInt32(&quotaCalls) != 1 || atomic.LoadInt32(&stringCalls) != 1 {
+		t.Errorf("expected 1 quota call and 1 string call, but got %d and %d", quotaCalls, stringCalls)
+	}
+
+	status := service.Status()
+	if status.Status != "ok" || status.Quota == nil || status.Quota.BitsRemaining != 40 {
+		t.Errorf("expected an ok status with 40 bits remaining, but got %+v", status)
+	}
+}
+
+// TestRandomOrgQuotaRefresh tests that the quota is fetched once for concurrent requests, without blocking the status,
+// and that a request canceled during the fetch doesn't cache its error
+func TestRandomOrgQuotaRefresh(t *testing.T) {
+	var quotaCalls int32
+	received, release := make(chan struct{}, 10), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&quotaCalls, 1)
+		received <- struct{}{}
+		select {
+		case <-release:
+			w.Write([]byte("100\n"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	quota := &services.RandomOrgQuota{Client: newTestRandomOrgService(server).Client, BaseURL: server.URL, TTL: time.Minute}
+
+	// The caller gives up while random.org is slow, its request is allowed and the quota is fetched again next time
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	if !quota.Allows(ctx, 60) {
+		t.Errorf("expected the request to be allowed while the quota can't be checked")
+	}
+	if status := quota.Status(); !status.CheckedAt.IsZero() || status.Error != "" {
+		t.Errorf("expected the canceled fetch not to be cached, got %+v", status)
+	}
+
+	var wg sync.WaitGroup
+	allowed := make([]bool, 3)
+	for i := range allowed {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			allowed[i] = quota.Allows(context.Background(), 60)
+		}(i)
+	}
+
+	<-received
+	done := make(chan services.QuotaStatus)
+	go func() { done <- quota.Status() }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the status not to wait for the quota")
+	}
+
+	release <- struct{}{}
+	wg.Wait()
+	for i, ok := range allowed {
+		if !ok {
+			t.Errorf("expected request %d to be allowed", i)
+		}
+	}
+	if calls := atomic.LoadInt32(&quotaCalls); calls != 2 {
+		t.Errorf("expected a single fetch for the concurrent requests, got %d fetches", calls-1)
+	}
+	if status := quota.Status(); status.BitsRemaining != 100 {
+		t.Errorf("expected 100 bits remaining, got %+v", status)
+	}
+}
+
+// TestRealRandomStringCustomAlphabet tests that custom alphabets are built from random.org integers
+func TestRealRandomStringCustomAlphabet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/integers/" || r.URL.Query().Get("max") != "2" || r.URL.Query().Get("num") != "6" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte("0\n1\n2\n2\n1\n0\n"))
+	}))
+	defer server.Close()
+
+	results, err := newTestRandomOrgService(server).GetRandomStrings(services.RandomStringOptions{Length: 3, Count: 2, Alphabet: "%#!", Unique: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 2 || results[0] != "%#!" || results[1] != "!#%" {
+		t.Errorf("expected [%%#! !#%%], but got %v", results)
+	}
+}
+
+// TestRealRandomSequence tests that random.org sequences are validated
+func TestRealRandomSequence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("max") == "2" {
+			w.Write([]byte("2\n0\n1\n"))
+			return
+		}
+		// Not a permutation
+		w.Write([]byte("0\n0\n"))
+	}))
+	defer server.Close()
+
+	service := newTestRandomOrgService(server)
+
+	sequence, err := service.GetRandomSequence(3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sequence) != 3 || sequence[0] != 2 || sequence[1] != 0 || sequence[2] != 1 {
+		t.Errorf("expected [2 0 1], but got %v", sequence)
+	}
+
+	if _, err := service.GetRandomSequence(2); err == nil {
+		t.Errorf("expected an error for an invalid sequence, but got nil")
+	}
+}
+
+// recordingObserver keeps the random.org calls it is told about
+type recordingObserver struct {
+	endpoints []string
+	errors    int
+}
+
+func (o *recordingObserver) ObserveRandomOrgCall(endpoint string, duration time.Duration, err error) {
+	o.endpoints = append(o.endpoints, endpoint)
+	if err != nil {
+		o.errors++
+	}
+}
+
+// TestRealRandomStringObserver tests that every call to random.org is reported with its endpoint
+func TestRealRandomStringObserver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/integers/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("abc\n"))
+	}))
+	defer server.Close()
+
+	observer := &recordingObserver{}
+	service := newTestRandomOrgService(server)
+	service.Observer = observer
+
+	service.GetRandomString(3)
+	service.GetRandomIntegers(1, 6, 1)
+
+	if len(observer.endpoints) != 2 || observer.endpoints[0] != "strings" || observer.endpoints[1] != "integers" {
+		t.Errorf("expected a strings and an integers call, got %v", observer.endpoints)
+	}
+	if observer.errors != 1 {
+		t.Errorf("expected 1 failed call, got %d", observer.errors)
+	}
+}
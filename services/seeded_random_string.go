@@ -0,0 +1,81 @@
+package services
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// SeededRandomStringService generates random strings and numbers with a PRNG, so the same seed always
+// produces the same results in the same order. It honors the length and charset like the real providers.
+// It is meant for tests and development, the results are predictable and must never be used in production
+type SeededRandomStringService struct {
+	Seed uint64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewSeededRandomStringService(seed uint64) *SeededRandomStringService {
+	return &SeededRandomStringService{
+		Seed: seed,
+		rng:  rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+func (s *SeededRandomStringService) GetRandomString(length int) (string, error) {
+	results, err := s.GetRandomStrings(DefaultRandomStringOptions(length))
+	if err != nil {
+		return "", err
+	}
+
+	return results[0], nil
+}
+
+func (s *SeededRandomStringService) GetRandomStrings(options RandomStringOptions) ([]string, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	characters := options.Characters()
+	return generateStrings(options, func() (string, error) {
+		result := make([]rune, options.Length)
+		for i := range result {
+			result[i] = characters[s.rng.IntN(len(characters))]
+		}
+		return string(result), nil
+	})
+}
+
+func (s *SeededRandomStringService) GetRandomIntegers(min, max int64, count int) ([]int64, error) {
+	if err := ValidateIntegerRange(min, max, count); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]int64, count)
+	for i := range results {
+		results[i] = min + s.rng.Int64N(max-min+1)
+	}
+
+	return results, nil
+}
+
+func (s *SeededRandomStringService) GetRandomSequence(n int) ([]int, error) {
+	if err := validateSequenceLength(n); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rng.Perm(n), nil
+}
+
+func (s *SeededRandomStringService) Status() ProviderStatus {
+	return ProviderStatus{Provider: "seeded", Status: "ok"}
+}
@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// TestSeededRandomStringDeterministic tests that the same seed produces the same strings and numbers
+func TestSeededRandomStringDeterministic(t *testing.T) {
+	first := services.NewSeededRandomStringService(42)
+	second := services.NewSeededRandomStringService(42)
+
+	options := services.DefaultRandomStringOptions(12)
+	options.Count = 5
+	firstStrings, _ := first.GetRandomStrings(options)
+	secondStrings, _ := second.GetRandomStrings(options)
+	if !reflect.DeepEqual(firstStrings, secondStrings) {
+		t.Errorf("expected the same strings for the same seed, got %v and %v", firstStrings, secondStrings)
+	}
+
+	firstIntegers, _ := first.GetRandomIntegers(1, 100, 5)
+	secondIntegers, _ := second.GetRandomIntegers(1, 100, 5)
+	if !reflect.DeepEqual(firstIntegers, secondIntegers) {
+		t.Errorf("expected the same integers for the same seed, got %v and %v", firstIntegers, secondIntegers)
+	}
+
+	other, _ := services.NewSeededRandomStringService(7).GetRandomStrings(options)
+	if reflect.DeepEqual(firstStrings, other) {
+		t.Errorf("expected different strings for a different seed, got %v", other)
+	}
+}
+
+// TestSeededRandomStringOptions tests that the length and charset are honored
+func TestSeededRandomStringOptions(t *testing.T) {
+	service := services.NewSeededRandomStringService(1)
+
+	results, err := service.GetRandomStrings(services.RandomStringOptions{Length: 8, Count: 20, Alphabet: "xyz", Unique: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, result := range results {
+		if len(result) != 8 || strings.Trim(result, "xyz") != "" {
+			t.Errorf("expected 8 characters from xyz, got %q", result)
+		}
+	}
+
+	if _, err := service.GetRandomString(21); err == nil {
+		t.Error("expected an error for length 21, but got nil")
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StatsEntry is a billed operation as used by the usage statistics
+type StatsEntry struct {
+	UserID      uint
+	Operation   string
+	Amount      float64
+	UserBalance float64
+	CreatedAt   time.Time
+}
+
+type OperationStats struct {
+	Operation   string  `json:"operation"`
+	Count       int     `json:"count"`
+	Spent       float64 `json:"spent"`
+	AverageCost float64 `json:"averageCost"`
+}
+
+type PeriodStats struct {
+	Period string  `json:"period"`
+	Count  int     `json:"count"`
+	Spent  float64 `json:"spent"`
+}
+
+type BalancePoint struct {
+	Date    string  `json:"date"`
+	Balance float64 `json:"balance"`
+}
+
+type UsageStats struct {
+	TotalOperations int              `json:"totalOperations"`
+	TotalSpent      float64          `json:"totalSpent"`
+	AverageCost     float64          `json:"averageCost"`
+	Operations      []OperationStats `json:"operations"`
+	Daily           []PeriodStats    `json:"daily"`
+	Weekly          []PeriodStats    `json:"weekly"`
+	Monthly         []PeriodStats    `json:"monthly"`
+	BalanceTrend    []BalancePoint   `json:"balanceTrend"`
+}
+
+// ComputeUsageStats aggregates the entries, which must be sorted by creation time.
+// The balance trend is the sum of every user's latest balance at the end of each day,
+// so it works for a single user as well as across all users
+func ComputeUsageStats(entries []StatsEntry) UsageStats {
+	stats := UsageStats{
+		Operations:   []OperationStats{},
+		Daily:        []PeriodStats{},
+		Weekly:       []PeriodStats{},
+		Monthly:      []PeriodStats{},
+		BalanceTrend: []BalancePoint{},
+	}
+
+	operations := map[string]*OperationStats{}
+	balances := map[uint]float64{}
+	totalBalance := 0.0
+	for _, entry := range entries {
+		stats.TotalOperations++
+		stats.TotalSpent += entry.Amount
+
+		operation, ok := operations[entry.Operation]
+		if !ok {
+			operation = &OperationStats{Operation: entry.Operation}
+			operations[entry.Operation] = operation
+		}
+		operation.Count++
+		operation.Spent += entry.Amount
+
+		createdAt := entry.CreatedAt.UTC()
+		year, week := createdAt.ISOWeek()
+		stats.Daily = addToPeriod(stats.Daily, createdAt.Format("2006-01-02"), entry.Amount)
+		stats.Weekly = addToPeriod(stats.Weekly, fmt.Sprintf("%d-W%02d", year, week), entry.Amount)
+		stats.Monthly = addToPeriod(stats.Monthly, createdAt.Format("2006-01"), entry.Amount)
+
+		totalBalance += entry.UserBalance - balances[entry.UserID]
+		balances[entry.UserID] = entry.UserBalance
+
+		date := createdAt.Format("2006-01-02")
+		if last := len(stats.BalanceTrend) - 1; last >= 0 && stats.BalanceTrend[last].Date == date {
+			stats.BalanceTrend[last].Balance = totalBalance
+		} else {
+			stats.BalanceTrend = append(stats.BalanceTrend, BalancePoint{Date: date, Balance: totalBalance})
+		}
+	}
+
+	if stats.TotalOperations > 0 {
+		stats.AverageCost = stats.TotalSpent / float64(stats.TotalOperations)
+	}
+
+	for _, operation := range operations {
+		operation.AverageCost = operation.Spent / float64(operation.Count)
+		stats.Operations = append(stats.Operations, *operation)
+	}
+	sort.Slice(stats.Operations, func(i, j int) bool {
+		return stats.Operations[i].Operation < stats.Operations[j].Operation
+	})
+
+	return stats
+}
+
+// addToPeriod adds the amount to the last period, or starts a new one since entries are sorted
+func addToPeriod(periods []PeriodStats, period string, amount float64) []PeriodStats {
+	if last := len(periods) - 1; last >= 0 && periods[last].Period == period {
+		periods[last].Count++
+		periods[last].Spent += amount
+		return periods
+	}
+
+	return append(periods, PeriodStats{Period: period, Count: 1, Spent: amount})
+}
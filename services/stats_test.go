@@ -0,0 +1,58 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ricardofabila/arithmetic-calculator-backend/services"
+)
+
+// TestComputeUsageStats tests the aggregates across two users and several days
+func TestComputeUsageStats(t *testing.T) {
+	day1 := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	day2 := time.Date(2026, 10, 2, 10, 0, 0, 0, time.UTC)
+	day3 := time.Date(2026, 11, 2, 10, 0, 0, 0, time.UTC)
+
+	entries := []services.StatsEntry{
+		{UserID: 1, Operation: "addition", Amount: 1, UserBalance: 49, CreatedAt: day1},
+		{UserID: 2, Operation: "division", Amount: 2, UserBalance: 48, CreatedAt: day1.Add(time.Hour)},
+		{UserID: 1, Operation: "addition", Amount: 1, UserBalance: 48, CreatedAt: day2},
+		{UserID: 1, Operation: "division", Amount: 2, UserBalance: 46, CreatedAt: day3},
+	}
+
+	stats := services.ComputeUsageStats(entries)
+
+	if stats.TotalOperations != 4 || stats.TotalSpent != 6 || stats.AverageCost != 1.5 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+
+	if len(stats.Operations) != 2 || stats.Operations[0].Operation != "addition" || stats.Operations[0].Count != 2 || stats.Operations[1].Spent != 4 {
+		t.Errorf("unexpected per operation stats: %+v", stats.Operations)
+	}
+
+	if len(stats.Daily) != 3 || stats.Daily[0].Period != "2026-10-01" || stats.Daily[0].Spent != 3 {
+		t.Errorf("unexpected daily stats: %+v", stats.Daily)
+	}
+
+	if len(stats.Weekly) != 2 || stats.Weekly[0].Period != "2026-W40" || stats.Weekly[0].Count != 3 {
+		t.Errorf("unexpected weekly stats: %+v", stats.Weekly)
+	}
+
+	if len(stats.Monthly) != 2 || stats.Monthly[1].Period != "2026-11" || stats.Monthly[1].Spent != 2 {
+		t.Errorf("unexpected monthly stats: %+v", stats.Monthly)
+	}
+
+	expectedTrend := []services.BalancePoint{
+		{Date: "2026-10-01", Balance: 97},
+		{Date: "2026-10-02", Balance: 96},
+		{Date: "2026-11-02", Balance: 94},
+	}
+	if len(stats.BalanceTrend) != len(expectedTrend) {
+		t.Fatalf("expected balance trend %v, but got %v", expectedTrend, stats.BalanceTrend)
+	}
+	for i, point := range expectedTrend {
+		if stats.BalanceTrend[i] != point {
+			t.Errorf("expected balance trend %v, but got %v", expectedTrend, stats.BalanceTrend)
+		}
+	}
+}